@@ -0,0 +1,456 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const apiKeysUsageSchema = `
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS usage_count BIGINT NOT NULL DEFAULT 0;
+`
+
+// Scope yang boleh diberikan ke key
+var validScopes = map[string]bool{
+	scopeAll:    true,
+	scopeRead:   true,
+	scopeExport: true,
+	scopeIngest: true,
+	scopeAdmin:  true,
+	scopeAlerts: true,
+}
+
+// Data key untuk admin (hash tidak pernah dikirim)
+type APIKeyInfo struct {
+	ID             int      `json:"id"`
+	Label          string   `json:"label"`
+	KeyPrefix      string   `json:"key_prefix"`
+	Key            string   `json:"key,omitempty"` // hanya saat create/rotate
+	Scopes         []string `json:"scopes"`
+	DevicePatterns []string `json:"device_patterns"`
+	DeviceGroups   []string `json:"device_groups"`
+	ExpiresAt      *string  `json:"expires_at"`
+	RevokedAt      *string  `json:"revoked_at"`
+	LastUsedAt     *string  `json:"last_used_at"`
+	UsageCount     int64    `json:"usage_count"`
+	CreatedAt      string   `json:"created_at"`
+}
+
+// Body create key
+type apiKeyRequest struct {
+	Label          string     `json:"label"`
+	Scopes         []string   `json:"scopes"`
+	DevicePatterns []string   `json:"device_patterns"`
+	DeviceGroups   []string   `json:"device_groups"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+// Body ubah expiry (null = tanpa expiry)
+type apiKeyExpiryRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+const apiKeyColumns = `id, label, key_prefix, scopes, device_patterns, device_groups,
+	expires_at, revoked_at, last_used_at, usage_count, created_at`
+
+// Key baru tidak boleh punya akses melebihi pembuatnya: scope, pola device dan grup
+// harus bagian dari identitas pembuat. Pola glob hanya boleh disalin persis dari pembuat,
+// device tunggal (tanpa karakter glob) boleh jika pembuat bisa mengaksesnya.
+func (id *Identity) canGrant(scopes, patterns, groups []string) error {
+	if id == nil {
+		return fmt.Errorf("token tidak dikenal")
+	}
+	for _, s := range scopes {
+		if !id.HasScope(s) {
+			return fmt.Errorf("tidak bisa memberi scope %s yang tidak dimiliki token ini", s)
+		}
+	}
+	if id.AllDevices {
+		return nil
+	}
+	for _, p := range patterns {
+		literal := !strings.ContainsAny(p, `*?[\`)
+		if !slices.Contains(id.DevicePatterns, p) && !(literal && id.CanAccessDevice(p)) {
+			return fmt.Errorf("tidak bisa memberi akses device %s di luar akses token ini", p)
+		}
+	}
+	for _, g := range groups {
+		if !slices.Contains(id.DeviceGroups, g) {
+			return fmt.Errorf("tidak bisa memberi grup device %s di luar akses token ini", g)
+		}
+	}
+	return nil
+}
+
+// Buat key acak baru: prefix tmk_ + 32 byte hex
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "tmk_" + hex.EncodeToString(buf), nil
+}
+
+// Format waktu nullable untuk JSON
+func nullTimeString(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	s := t.Time.Format(time.RFC3339)
+	return &s
+}
+
+// Scan satu baris api_keys
+func scanAPIKey(scanner interface{ Scan(...interface{}) error }) (APIKeyInfo, error) {
+	var k APIKeyInfo
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	var createdAt time.Time
+	err := scanner.Scan(&k.ID, &k.Label, &k.KeyPrefix, pq.Array(&k.Scopes), pq.Array(&k.DevicePatterns),
+		pq.Array(&k.DeviceGroups), &expiresAt, &revokedAt, &lastUsedAt, &k.UsageCount, &createdAt)
+	if err != nil {
+		return k, err
+	}
+	k.ExpiresAt = nullTimeString(expiresAt)
+	k.RevokedAt = nullTimeString(revokedAt)
+	k.LastUsedAt = nullTimeString(lastUsedAt)
+	k.CreatedAt = createdAt.Format(time.RFC3339)
+	return k, nil
+}
+
+// Handler: /api/admin/keys (GET list, POST create)
+func adminKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listAPIKeys(w, r)
+	case http.MethodPost:
+		createAPIKey(w, r)
+	default:
+		respondError(w, "method harus GET atau POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handler: /api/admin/keys/{id} (GET detail, PATCH expiry, DELETE revoke)
+func adminKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, "id key tidak valid", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		manageAPIKey(w, r, "detail", id, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`)
+	case http.MethodPatch:
+		var req apiKeyExpiryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "JSON tidak valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		manageAPIKey(w, r, "expiry", id, `
+			UPDATE api_keys SET expires_at = $2
+			WHERE id = $1
+			RETURNING `+apiKeyColumns, req.ExpiresAt)
+	case http.MethodDelete:
+		manageAPIKey(w, r, "revoke", id, `
+			UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+			WHERE id = $1
+			RETURNING `+apiKeyColumns)
+	default:
+		respondError(w, "method harus GET, PATCH atau DELETE", http.StatusMethodNotAllowed)
+	}
+}
+
+// Jalankan query ($1 = id, hasil apiKeyColumns) pada satu key yang boleh dikelola pemanggil.
+// Key dikunci lalu dicek dengan canGrant, agar key admin terbatas tidak bisa melihat,
+// memperpanjang atau mencabut key yang aksesnya lebih luas.
+func manageAPIKey(w http.ResponseWriter, r *http.Request, mode string, id int, query string, args ...interface{}) {
+	tx, err := db.Begin()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var scopes, patterns, groups []string
+	err = tx.QueryRow(`
+		SELECT scopes, device_patterns, device_groups FROM api_keys
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(pq.Array(&scopes), pq.Array(&patterns), pq.Array(&groups))
+	if err == sql.ErrNoRows {
+		respondError(w, "key tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := identityFromContext(r.Context()).canGrant(scopes, patterns, groups); err != nil {
+		respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	k, err := scanAPIKey(tx.QueryRow(query, append([]interface{}{id}, args...)...))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if mode != "detail" {
+		invalidateAPIKeyCache()
+	}
+
+	respond(w, Response{
+		Status: true,
+		Filter: "api_keys",
+		Mode:   mode,
+		Total:  1,
+		Data:   k,
+	})
+}
+
+// Handler: POST /api/admin/keys/{id}/rotate
+// Key lama dicabut, key baru dengan setting yang sama dibuat
+func adminRotateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "method harus POST", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, "id key tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Key hasil rotate mewarisi akses key lama, jadi pembuat harus mampu memberikannya
+	var scopes, patterns, groups []string
+	err = tx.QueryRow(`
+		SELECT scopes, device_patterns, device_groups FROM api_keys
+		WHERE id = $1 AND revoked_at IS NULL
+		FOR UPDATE
+	`, id).Scan(pq.Array(&scopes), pq.Array(&patterns), pq.Array(&groups))
+	if err == sql.ErrNoRows {
+		respondError(w, "key tidak ditemukan atau sudah dicabut", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := identityFromContext(r.Context()).canGrant(scopes, patterns, groups); err != nil {
+		respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	row := tx.QueryRow(`
+		WITH old AS (
+			UPDATE api_keys SET revoked_at = NOW()
+			WHERE id = $1 AND revoked_at IS NULL
+			RETURNING label, scopes, device_patterns, device_groups, expires_at
+		)
+		INSERT INTO api_keys (label, key_prefix, key_hash, scopes, device_patterns, device_groups, expires_at)
+		SELECT label, $2, $3, scopes, device_patterns, device_groups, expires_at FROM old
+		RETURNING `+apiKeyColumns, id, key[:12], hashAPIKey(key))
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		respondError(w, "key tidak ditemukan atau sudah dicabut", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invalidateAPIKeyCache()
+
+	k.Key = key
+	respond(w, Response{
+		Status:  true,
+		Filter:  "api_keys",
+		Mode:    "rotate",
+		Total:   1,
+		Data:    k,
+		Message: "Simpan key ini, key tidak akan ditampilkan lagi",
+	})
+}
+
+// Daftar key, hanya yang aksesnya bisa diberikan pemanggil
+func listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+	rows, err := db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id`)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	keys := []APIKeyInfo{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil || identity.canGrant(k.Scopes, k.DevicePatterns, k.DeviceGroups) != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	respond(w, Response{
+		Status: true,
+		Filter: "api_keys",
+		Mode:   "list",
+		Total:  len(keys),
+		Data:   keys,
+	})
+}
+
+func createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "JSON tidak valid: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Label == "" {
+		respondError(w, "label wajib diisi", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{scopeRead}
+	}
+	for _, s := range req.Scopes {
+		if !validScopes[s] {
+			respondError(w, fmt.Sprintf("scope tidak dikenal: %s", s), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(req.DevicePatterns) == 0 && len(req.DeviceGroups) == 0 {
+		respondError(w, "device_patterns atau device_groups wajib diisi (gunakan [\"*\"] untuk semua device)", http.StatusBadRequest)
+		return
+	}
+	if req.DevicePatterns == nil {
+		req.DevicePatterns = []string{}
+	}
+	if req.DeviceGroups == nil {
+		req.DeviceGroups = []string{}
+	}
+	if err := identityFromContext(r.Context()).canGrant(req.Scopes, req.DevicePatterns, req.DeviceGroups); err != nil {
+		respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	row := db.QueryRow(`
+		INSERT INTO api_keys (label, key_prefix, key_hash, scopes, device_patterns, device_groups, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		req.Label, key[:12], hashAPIKey(key), pq.Array(req.Scopes), pq.Array(req.DevicePatterns),
+		pq.Array(req.DeviceGroups), req.ExpiresAt)
+	respondAPIKey(w, "create", row, key)
+}
+
+// Kirim satu key sebagai response; key mentah hanya diisi saat create
+func respondAPIKey(w http.ResponseWriter, mode string, row *sql.Row, rawKey string) {
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		respondError(w, "key tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if mode != "detail" {
+		invalidateAPIKeyCache()
+	}
+
+	resp := Response{
+		Status: true,
+		Filter: "api_keys",
+		Mode:   mode,
+		Total:  1,
+		Data:   k,
+	}
+	if rawKey != "" {
+		k.Key = rawKey
+		resp.Data = k
+		resp.Message = "Simpan key ini, key tidak akan ditampilkan lagi"
+	}
+	respond(w, resp)
+}
+
+// ===============================
+// PENCATATAN PEMAKAIAN KEY
+// ===============================
+
+var (
+	keyUsageMu sync.Mutex
+	keyUsage   = map[int]int64{}
+)
+
+// Catat pemakaian key di memori, ditulis ke database secara berkala
+func recordKeyUsage(keyID int) {
+	if keyID == 0 {
+		return
+	}
+	keyUsageMu.Lock()
+	keyUsage[keyID]++
+	keyUsageMu.Unlock()
+}
+
+// Worker: tulis last_used_at dan usage_count tiap interval
+func keyUsageWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		flushKeyUsage()
+	}
+}
+
+func flushKeyUsage() {
+	keyUsageMu.Lock()
+	pending := keyUsage
+	keyUsage = map[int]int64{}
+	keyUsageMu.Unlock()
+
+	for keyID, count := range pending {
+		_, err := db.Exec(`
+			UPDATE api_keys SET last_used_at = NOW(), usage_count = usage_count + $2
+			WHERE id = $1
+		`, keyID, count)
+		if err != nil {
+			log.Println("flush key usage:", err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestCanGrant(t *testing.T) {
+	limited := &Identity{
+		Scopes:         []string{scopeAdmin, scopeRead},
+		DevicePatterns: []string{"pabrik-*"},
+		DeviceGroups:   []string{"gudang"},
+		Devices:        map[string]bool{"gudang-01": true},
+	}
+	root := &Identity{Scopes: []string{scopeAll}, AllDevices: true}
+
+	tests := []struct {
+		name     string
+		id       *Identity
+		scopes   []string
+		patterns []string
+		groups   []string
+		wantErr  bool
+	}{
+		{"subset", limited, []string{scopeRead}, []string{"pabrik-*"}, []string{"gudang"}, false},
+		{"device tunggal dalam pola", limited, []string{scopeRead}, []string{"pabrik-07"}, nil, false},
+		{"device tunggal dari grup", limited, []string{scopeRead}, []string{"gudang-01"}, nil, false},
+		{"scope lebih luas", limited, []string{scopeIngest}, []string{"pabrik-*"}, nil, true},
+		{"scope semua", limited, []string{scopeAll}, []string{"pabrik-*"}, nil, true},
+		{"pola semua device", limited, []string{scopeRead}, []string{"*"}, nil, true},
+		{"pola lebih luas", limited, []string{scopeRead}, []string{"pabrik*"}, nil, true},
+		{"device di luar akses", limited, []string{scopeRead}, []string{"kantor-01"}, nil, true},
+		{"grup lain", limited, []string{scopeRead}, nil, []string{"kantor"}, true},
+		{"root bebas", root, []string{scopeAll}, []string{"*"}, []string{"kantor"}, false},
+		{"tanpa identitas", nil, []string{scopeRead}, []string{"pabrik-01"}, nil, true},
+	}
+	for _, tt := range tests {
+		err := tt.id.canGrant(tt.scopes, tt.patterns, tt.groups)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const alertsSchema = `
+CREATE TABLE IF NOT EXISTS alert_rules (
+	id               SERIAL PRIMARY KEY,
+	name             TEXT NOT NULL,
+	device_unique_id TEXT NOT NULL,
+	parameter_name   TEXT NOT NULL,
+	operator         TEXT NOT NULL CHECK (operator IN ('>', '<', 'outside')),
+	threshold        DOUBLE PRECISION NOT NULL,
+	threshold_high   DOUBLE PRECISION,
+	duration_seconds INTEGER NOT NULL DEFAULT 0,
+	hysteresis       DOUBLE PRECISION NOT NULL DEFAULT 0,
+	webhook_urls     TEXT[] NOT NULL DEFAULT '{}',
+	enabled          BOOLEAN NOT NULL DEFAULT TRUE,
+	state            TEXT NOT NULL DEFAULT 'ok',
+	pending_since    TIMESTAMP,
+	state_changed_at TIMESTAMPTZ,
+	last_value       DOUBLE PRECISION,
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS alert_rules_device_idx ON alert_rules (device_unique_id, parameter_name);
+CREATE TABLE IF NOT EXISTS alert_events (
+	id          BIGSERIAL PRIMARY KEY,
+	rule_id     INTEGER NOT NULL REFERENCES alert_rules (id) ON DELETE CASCADE,
+	event       TEXT NOT NULL,
+	value       DOUBLE PRECISION NOT NULL,
+	recorded_at TIMESTAMP NOT NULL,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS alert_events_rule_idx ON alert_events (rule_id, id DESC);
+`
+
+// Operator rule
+const (
+	alertAbove   = ">"
+	alertBelow   = "<"
+	alertOutside = "outside"
+)
+
+// State rule: ok -> pending (kondisi terpenuhi, menunggu durasi) -> firing
+const (
+	alertOK       = "ok"
+	alertPending  = "pending"
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+const alertReloadInterval = time.Minute
+
+// Rule alert. Untuk operator outside, Threshold = batas bawah dan ThresholdHigh = batas atas.
+type AlertRule struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	DeviceUniqueID  string   `json:"device_unique_id"`
+	ParameterName   string   `json:"parameter_name"`
+	Operator        string   `json:"operator"`
+	Threshold       float64  `json:"threshold"`
+	ThresholdHigh   *float64 `json:"threshold_high"`
+	DurationSeconds int      `json:"duration_seconds"`
+	Hysteresis      float64  `json:"hysteresis"`
+	WebhookURLs     []string `json:"webhook_urls"`
+	Enabled         bool     `json:"enabled"`
+	State           string   `json:"state"`
+	StateChangedAt  *string  `json:"state_changed_at"`
+	LastValue       *float64 `json:"last_value"`
+	CreatedAt       string   `json:"created_at"`
+
+	pendingSince time.Time // WIB tanpa zona, seperti recorded_at
+	lastAt       time.Time
+}
+
+// Body create/update rule
+type alertRuleRequest struct {
+	Name            string   `json:"name"`
+	DeviceUniqueID  string   `json:"device_unique_id"`
+	ParameterName   string   `json:"parameter_name"`
+	Operator        string   `json:"operator"`
+	Threshold       *float64 `json:"threshold"`
+	ThresholdHigh   *float64 `json:"threshold_high"`
+	DurationSeconds int      `json:"duration_seconds"`
+	Hysteresis      float64  `json:"hysteresis"`
+	WebhookURLs     []string `json:"webhook_urls"`
+	Enabled         *bool    `json:"enabled"`
+}
+
+// Payload webhook alert
+type AlertEvent struct {
+	Event          string   `json:"event"` // firing | resolved
+	RuleID         int      `json:"rule_id"`
+	RuleName       string   `json:"rule_name"`
+	DeviceUniqueID string   `json:"device_unique_id"`
+	ParameterName  string   `json:"parameter_name"`
+	Operator       string   `json:"operator"`
+	Threshold      float64  `json:"threshold"`
+	ThresholdHigh  *float64 `json:"threshold_high,omitempty"`
+	Value          float64  `json:"value"`
+	RecordedAt     string   `json:"recorded_at"`
+	Since          string   `json:"since"`
+	Timezone       string   `json:"timezone"`
+}
+
+// Riwayat event di alert_events
+type AlertEventLog struct {
+	ID         int     `json:"id"`
+	RuleID     int     `json:"rule_id"`
+	RuleName   string  `json:"rule_name"`
+	DeviceID   string  `json:"device_unique_id"`
+	Parameter  string  `json:"parameter_name"`
+	Event      string  `json:"event"`
+	Value      float64 `json:"value"`
+	RecordedAt string  `json:"recorded_at"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+const alertRuleColumns = `id, name, device_unique_id, parameter_name, operator, threshold, threshold_high,
+	duration_seconds, hysteresis, webhook_urls, enabled, state, pending_since, state_changed_at,
+	last_value, created_at`
+
+// Scan satu baris alert_rules
+func scanAlertRule(scanner interface{ Scan(...interface{}) error }) (*AlertRule, error) {
+	var rule AlertRule
+	var thresholdHigh, lastValue sql.NullFloat64
+	var pendingSince, stateChangedAt sql.NullTime
+	var createdAt time.Time
+	err := scanner.Scan(&rule.ID, &rule.Name, &rule.DeviceUniqueID, &rule.ParameterName, &rule.Operator,
+		&rule.Threshold, &thresholdHigh, &rule.DurationSeconds, &rule.Hysteresis, pq.Array(&rule.WebhookURLs),
+		&rule.Enabled, &rule.State, &pendingSince, &stateChangedAt, &lastValue, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if thresholdHigh.Valid {
+		rule.ThresholdHigh = &thresholdHigh.Float64
+	}
+	if lastValue.Valid {
+		rule.LastValue = &lastValue.Float64
+	}
+	if pendingSince.Valid {
+		rule.pendingSince = pendingSince.Time
+	}
+	rule.StateChangedAt = nullTimeString(stateChangedAt)
+	rule.CreatedAt = createdAt.Format(time.RFC3339)
+	if rule.WebhookURLs == nil {
+		rule.WebhookURLs = []string{}
+	}
+	return &rule, nil
+}
+
+// Nilai melanggar threshold
+func (r *AlertRule) breached(v float64) bool {
+	switch r.Operator {
+	case alertAbove:
+		return v > r.Threshold
+	case alertBelow:
+		return v < r.Threshold
+	case alertOutside:
+		return v < r.Threshold || v > *r.ThresholdHigh
+	}
+	return false
+}
+
+// Nilai sudah kembali normal dengan margin hysteresis
+func (r *AlertRule) cleared(v float64) bool {
+	switch r.Operator {
+	case alertAbove:
+		return v <= r.Threshold-r.Hysteresis
+	case alertBelow:
+		return v >= r.Threshold+r.Hysteresis
+	case alertOutside:
+		return v >= r.Threshold+r.Hysteresis && v <= *r.ThresholdHigh-r.Hysteresis
+	}
+	return false
+}
+
+func (req *alertRuleRequest) validate() error {
+	if req.DeviceUniqueID == "" || req.ParameterName == "" {
+		return fmt.Errorf("device_unique_id dan parameter_name wajib diisi")
+	}
+	if req.Threshold == nil {
+		return fmt.Errorf("threshold wajib diisi")
+	}
+	switch req.Operator {
+	case alertAbove, alertBelow:
+		req.ThresholdHigh = nil
+	case alertOutside:
+		if req.ThresholdHigh == nil || *req.ThresholdHigh <= *req.Threshold {
+			return fmt.Errorf("operator outside butuh threshold_high > threshold")
+		}
+	default:
+		return fmt.Errorf("operator harus >, < atau outside")
+	}
+	if req.DurationSeconds < 0 || req.Hysteresis < 0 {
+		return fmt.Errorf("duration_seconds dan hysteresis tidak boleh negatif")
+	}
+	// Alert outside baru resolved di antara threshold+hysteresis dan threshold_high-hysteresis;
+	// rentang itu tidak boleh kosong agar alert bisa selesai
+	if req.Operator == alertOutside && 2*req.Hysteresis >= *req.ThresholdHigh-*req.Threshold {
+		return fmt.Errorf("hysteresis harus kurang dari setengah selisih threshold_high dan threshold")
+	}
+	for _, u := range req.WebhookURLs {
+		if err := validatePublicWebhookURL(u); err != nil {
+			return err
+		}
+	}
+	if len(req.WebhookURLs) == 0 && len(config.AlertWebhooks) == 0 {
+		return fmt.Errorf("webhook_urls wajib diisi (tidak ada alert_webhooks di config)")
+	}
+	if config.WebhookSecret == "" {
+		return fmt.Errorf("webhook_secret belum dikonfigurasi")
+	}
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("%s %s %s %g", req.DeviceUniqueID, req.ParameterName, req.Operator, *req.Threshold)
+	}
+	if req.WebhookURLs == nil {
+		req.WebhookURLs = []string{}
+	}
+	return nil
+}
+
+// ===============================
+// ENGINE
+// ===============================
+
+// Rule aktif di memori, dikelompokkan per device/parameter
+type alertEngine struct {
+	mu    sync.Mutex
+	rules map[string][]*AlertRule
+
+	// Transisi yang belum ditulis ke database, diproses writer di luar jalur hub
+	pendingMu sync.Mutex
+	pending   []alertChange
+	wake      chan struct{}
+}
+
+var alerts = &alertEngine{
+	rules: map[string][]*AlertRule{},
+	wake:  make(chan struct{}, 1),
+}
+
+// Satu transisi rule beserta salinan rule saat itu
+type alertChange struct {
+	rule AlertRule
+	step alertStep
+	lr   liveReading
+}
+
+func alertKey(device, param string) string {
+	return device + "\x00" + param
+}
+
+// Muat ulang rule aktif dari database (state ikut dimuat)
+func (e *alertEngine) reload() error {
+	rows, err := db.Query(`SELECT ` + alertRuleColumns + ` FROM alert_rules WHERE enabled`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	rules := map[string][]*AlertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			continue
+		}
+		key := alertKey(rule.DeviceUniqueID, rule.ParameterName)
+		rules[key] = append(rules[key], rule)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// Pertahankan waktu pembacaan terakhir agar data telat tetap diabaikan
+	for key, list := range rules {
+		for _, rule := range list {
+			for _, old := range e.rules[key] {
+				if old.ID == rule.ID {
+					rule.lastAt = old.lastAt
+				}
+			}
+		}
+	}
+	e.rules = rules
+	return nil
+}
+
+// Jalankan engine: terima batch dari hub dan muat ulang rule berkala
+func (e *alertEngine) run() {
+	if err := e.reload(); err != nil {
+		log.Println("alert engine:", err)
+	}
+	go e.writer()
+	liveHub.handle(e.evaluate)
+
+	ticker := time.NewTicker(alertReloadInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := e.reload(); err != nil {
+			log.Println("alert engine:", err)
+		}
+	}
+}
+
+// Evaluasi batch baris baru terhadap rule. Hanya menghitung transisi; penulisan ke
+// database dan webhook dikerjakan writer agar database lambat tidak menahan hub.
+func (e *alertEngine) evaluate(batch []liveReading) {
+	var changes []alertChange
+	e.mu.Lock()
+	for _, lr := range batch {
+		for _, rule := range e.rules[alertKey(lr.DeviceUniqueID, lr.ParameterName)] {
+			step := rule.step(lr)
+			if step.Changed || step.Event != "" {
+				changes = append(changes, alertChange{rule: *rule, step: step, lr: lr})
+			}
+		}
+	}
+	e.mu.Unlock()
+	if len(changes) == 0 {
+		return
+	}
+
+	e.pendingMu.Lock()
+	e.pending = append(e.pending, changes...)
+	e.pendingMu.Unlock()
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Worker: tulis transisi yang tertunda setiap kali dibangunkan evaluate
+func (e *alertEngine) writer() {
+	for range e.wake {
+		e.flush()
+	}
+}
+
+// Tulis state (cukup yang terakhir per rule) dan event sesuai urutan terjadinya
+func (e *alertEngine) flush() {
+	e.pendingMu.Lock()
+	changes := e.pending
+	e.pending = nil
+	e.pendingMu.Unlock()
+
+	last := map[int]int{}
+	for i, c := range changes {
+		if c.step.Changed {
+			last[c.rule.ID] = i
+		}
+	}
+	for i := range changes {
+		c := &changes[i]
+		if c.step.Changed && last[c.rule.ID] == i {
+			e.saveState(&c.rule, c.lr)
+		}
+		if c.step.Event != "" {
+			e.fire(&c.rule, c.step, c.lr)
+		}
+	}
+}
+
+// Hasil satu langkah state machine rule
+type alertStep struct {
+	Changed bool      // state atau pending_since berubah
+	Event   string    // firing | resolved, kosong jika tidak ada event
+	Since   time.Time // awal kondisi melanggar, untuk payload event
+}
+
+// Transisi state satu rule untuk satu pembacaan (tanpa I/O)
+func (r *AlertRule) step(lr liveReading) alertStep {
+	// Data telat (lebih tua dari yang sudah dievaluasi) diabaikan
+	if lr.RecordedAt.Before(r.lastAt) {
+		return alertStep{}
+	}
+	r.lastAt = lr.RecordedAt
+	duration := time.Duration(r.DurationSeconds) * time.Second
+
+	var step alertStep
+	switch r.State {
+	case alertOK:
+		if !r.breached(lr.Value) {
+			return step
+		}
+		r.pendingSince = lr.RecordedAt
+		r.State = alertPending
+		if duration == 0 {
+			r.State, step.Event = alertFiring, alertFiring
+		}
+	case alertPending:
+		if !r.breached(lr.Value) {
+			r.pendingSince = time.Time{}
+			r.State = alertOK
+			break
+		}
+		if lr.RecordedAt.Sub(r.pendingSince) < duration {
+			return step
+		}
+		r.State, step.Event = alertFiring, alertFiring
+	case alertFiring:
+		if !r.cleared(lr.Value) {
+			return step
+		}
+		step.Event, step.Since = alertResolved, r.pendingSince
+		r.State = alertOK
+		r.pendingSince = time.Time{}
+	default:
+		return step
+	}
+
+	step.Changed = true
+	if step.Event == alertFiring {
+		step.Since = r.pendingSince
+	}
+	r.LastValue = &lr.Value
+	return step
+}
+
+// Simpan state rule ke database
+func (e *alertEngine) saveState(rule *AlertRule, lr liveReading) {
+	var pendingSince interface{}
+	if !rule.pendingSince.IsZero() {
+		pendingSince = rule.pendingSince
+	}
+	_, err := db.Exec(`
+		UPDATE alert_rules SET state = $2, pending_since = $3, last_value = $4, state_changed_at = NOW()
+		WHERE id = $1
+	`, rule.ID, rule.State, pendingSince, lr.Value)
+	if err != nil {
+		log.Println("alert state:", err)
+	}
+}
+
+// Catat event firing/resolved dan kirim ke webhook
+func (e *alertEngine) fire(rule *AlertRule, step alertStep, lr liveReading) {
+	if _, err := db.Exec(`
+		INSERT INTO alert_events (rule_id, event, value, recorded_at) VALUES ($1, $2, $3, $4)
+	`, rule.ID, step.Event, lr.Value, lr.RecordedAt); err != nil {
+		log.Println("alert event:", err)
+	}
+
+	zona, _ := resolveZona("")
+	payload := AlertEvent{
+		Event:          step.Event,
+		RuleID:         rule.ID,
+		RuleName:       rule.Name,
+		DeviceUniqueID: rule.DeviceUniqueID,
+		ParameterName:  rule.ParameterName,
+		Operator:       rule.Operator,
+		Threshold:      rule.Threshold,
+		ThresholdHigh:  rule.ThresholdHigh,
+		Value:          lr.Value,
+		RecordedAt:     zona.FromDatabase(lr.RecordedAt).Format("2006-01-02 15:04:05"),
+		Timezone:       zona.Label,
+	}
+	if !step.Since.IsZero() {
+		payload.Since = zona.FromDatabase(step.Since).Format("2006-01-02 15:04:05")
+	}
+	log.Printf("🔔 Alert %s: %s (%s %s = %g)", step.Event, rule.Name, rule.DeviceUniqueID, rule.ParameterName, lr.Value)
+
+	// Webhook milik rule diisi user lewat API, jadi hanya boleh ke alamat publik
+	if len(rule.WebhookURLs) > 0 {
+		enqueuePublicWebhook(rule.WebhookURLs, "alert."+step.Event, payload)
+		return
+	}
+	enqueueWebhook(config.AlertWebhooks, "alert."+step.Event, payload)
+}
+
+// ===============================
+// HANDLER
+// ===============================
+
+// Handler: /api/alerts/rules (GET list, POST create)
+func alertRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listAlertRules(w, r)
+	case http.MethodPost:
+		var req alertRuleRequest
+		if !decodeAlertRule(w, r, &req) {
+			return
+		}
+		enabled := req.Enabled == nil || *req.Enabled
+		row := db.QueryRow(`
+			INSERT INTO alert_rules (name, device_unique_id, parameter_name, operator, threshold, threshold_high,
+				duration_seconds, hysteresis, webhook_urls, enabled)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING `+alertRuleColumns,
+			req.Name, req.DeviceUniqueID, req.ParameterName, req.Operator, *req.Threshold, req.ThresholdHigh,
+			req.DurationSeconds, req.Hysteresis, pq.Array(req.WebhookURLs), enabled)
+		respondAlertRule(w, "create", row)
+	default:
+		respondError(w, "method harus GET atau POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handler: /api/alerts/rules/{id} (GET detail, PUT ganti, DELETE hapus)
+// Mengubah rule me-reset state ke ok tanpa mengirim event resolved.
+func alertRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, "id rule tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	// Rule device lain tidak terlihat oleh token ini
+	existing, err := scanAlertRule(db.QueryRow(`SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = $1`, id))
+	if err == nil && !identityFromContext(r.Context()).CanAccessDevice(existing.DeviceUniqueID) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondError(w, "rule tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respond(w, Response{Status: true, Filter: "alert_rules", Mode: "detail", Total: 1, Data: existing})
+	case http.MethodPut:
+		var req alertRuleRequest
+		if !decodeAlertRule(w, r, &req) {
+			return
+		}
+		enabled := req.Enabled == nil || *req.Enabled
+		row := db.QueryRow(`
+			UPDATE alert_rules SET name = $2, device_unique_id = $3, parameter_name = $4, operator = $5,
+				threshold = $6, threshold_high = $7, duration_seconds = $8, hysteresis = $9,
+				webhook_urls = $10, enabled = $11, state = 'ok', pending_since = NULL, state_changed_at = NOW()
+			WHERE id = $1
+			RETURNING `+alertRuleColumns,
+			id, req.Name, req.DeviceUniqueID, req.ParameterName, req.Operator, *req.Threshold, req.ThresholdHigh,
+			req.DurationSeconds, req.Hysteresis, pq.Array(req.WebhookURLs), enabled)
+		respondAlertRule(w, "update", row)
+	case http.MethodDelete:
+		row := db.QueryRow(`DELETE FROM alert_rules WHERE id = $1 RETURNING `+alertRuleColumns, id)
+		respondAlertRule(w, "delete", row)
+	default:
+		respondError(w, "method harus GET, PUT atau DELETE", http.StatusMethodNotAllowed)
+	}
+}
+
+// Decode dan validasi body rule; tulis error jika gagal
+func decodeAlertRule(w http.ResponseWriter, r *http.Request, req *alertRuleRequest) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		respondError(w, "JSON tidak valid: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := req.validate(); err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if !identityFromContext(r.Context()).CanAccessDevice(req.DeviceUniqueID) {
+		respondError(w, "Token tidak punya akses ke device ini", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func listAlertRules(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`SELECT ` + alertRuleColumns + ` FROM alert_rules ORDER BY id`)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	identity := identityFromContext(r.Context())
+	rules := []*AlertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil || !identity.CanAccessDevice(rule.DeviceUniqueID) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	respond(w, Response{
+		Status: true,
+		Filter: "alert_rules",
+		Mode:   "list",
+		Total:  len(rules),
+		Data:   rules,
+	})
+}
+
+// Kirim satu rule sebagai response dan muat ulang engine
+func respondAlertRule(w http.ResponseWriter, mode string, row *sql.Row) {
+	rule, err := scanAlertRule(row)
+	if err == sql.ErrNoRows {
+		respondError(w, "rule tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := alerts.reload(); err != nil {
+		log.Println("alert engine:", err)
+	}
+	respond(w, Response{
+		Status: true,
+		Filter: "alert_rules",
+		Mode:   mode,
+		Total:  1,
+		Data:   rule,
+	})
+}
+
+// Handler: GET /api/alerts/events?rule_id=1&limit=100
+func alertEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method harus GET", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > 1000 {
+			respondError(w, "limit harus 1-1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var ruleID interface{}
+	if s := q.Get("rule_id"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			respondError(w, "rule_id tidak valid", http.StatusBadRequest)
+			return
+		}
+		ruleID = n
+	}
+	zona, err := resolveZona(q.Get("zonawaktu"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Device yang boleh dilihat disaring di SQL agar LIMIT dihitung setelah penyaringan
+	identity := identityFromContext(r.Context())
+	var devices interface{}
+	if identity == nil || !identity.AllDevices {
+		allowed, err := alertRuleDevices(identity)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		devices = pq.Array(allowed)
+	}
+
+	rows, err := db.Query(`
+		SELECT e.id, e.rule_id, r.name, r.device_unique_id, r.parameter_name, e.event, e.value, e.recorded_at, e.created_at
+		FROM alert_events e
+		JOIN alert_rules r ON r.id = e.rule_id
+		WHERE ($1::int IS NULL OR e.rule_id = $1)
+		  AND ($3::text[] IS NULL OR r.device_unique_id = ANY($3))
+		ORDER BY e.id DESC
+		LIMIT $2
+	`, ruleID, limit, devices)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []AlertEventLog{}
+	for rows.Next() {
+		var ev AlertEventLog
+		var recordedAt, createdAt time.Time
+		if err := rows.Scan(&ev.ID, &ev.RuleID, &ev.RuleName, &ev.DeviceID, &ev.Parameter, &ev.Event,
+			&ev.Value, &recordedAt, &createdAt); err != nil {
+			continue
+		}
+		ev.RecordedAt = zona.FromDatabase(recordedAt).Format("2006-01-02 15:04:05")
+		ev.CreatedAt = createdAt.In(zona.Loc).Format(time.RFC3339)
+		events = append(events, ev)
+	}
+
+	respond(w, Response{
+		Status:   true,
+		Filter:   "alert_events",
+		Mode:     "list",
+		Timezone: zona.Label,
+		Total:    len(events),
+		Data:     events,
+	})
+}
+
+// Device yang punya rule dan bisa diakses identitas
+func alertRuleDevices(identity *Identity) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT device_unique_id FROM alert_rules`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return identity.FilterDevices(devices), nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertRuleThresholds(t *testing.T) {
+	high := 30.0
+	tests := []struct {
+		rule     AlertRule
+		value    float64
+		breached bool
+		cleared  bool
+	}{
+		{AlertRule{Operator: alertAbove, Threshold: 50, Hysteresis: 2}, 51, true, false},
+		{AlertRule{Operator: alertAbove, Threshold: 50, Hysteresis: 2}, 49, false, false},
+		{AlertRule{Operator: alertAbove, Threshold: 50, Hysteresis: 2}, 48, false, true},
+		{AlertRule{Operator: alertBelow, Threshold: 10, Hysteresis: 1}, 9, true, false},
+		{AlertRule{Operator: alertBelow, Threshold: 10, Hysteresis: 1}, 11, false, true},
+		{AlertRule{Operator: alertOutside, Threshold: 20, ThresholdHigh: &high, Hysteresis: 1}, 31, true, false},
+		{AlertRule{Operator: alertOutside, Threshold: 20, ThresholdHigh: &high, Hysteresis: 1}, 29.5, false, false},
+		{AlertRule{Operator: alertOutside, Threshold: 20, ThresholdHigh: &high, Hysteresis: 1}, 25, false, true},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.breached(tt.value); got != tt.breached {
+			t.Errorf("%s %g breached(%g) = %v", tt.rule.Operator, tt.rule.Threshold, tt.value, got)
+		}
+		if got := tt.rule.cleared(tt.value); got != tt.cleared {
+			t.Errorf("%s %g cleared(%g) = %v", tt.rule.Operator, tt.rule.Threshold, tt.value, got)
+		}
+	}
+}
+
+func TestAlertRuleStep(t *testing.T) {
+	base := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	type reading struct {
+		at    time.Duration
+		value float64
+		state string
+		event string
+	}
+	tests := []struct {
+		name     string
+		duration int
+		readings []reading
+	}{
+		{"tanpa durasi langsung firing", 0, []reading{
+			{0, 40, alertOK, ""},
+			{time.Minute, 55, alertFiring, alertFiring},
+			{2 * time.Minute, 60, alertFiring, ""},
+			{3 * time.Minute, 49, alertFiring, ""}, // masih dalam hysteresis
+			{4 * time.Minute, 47, alertOK, alertResolved},
+		}},
+		{"pending sampai durasi", 300, []reading{
+			{0, 55, alertPending, ""},
+			{2 * time.Minute, 56, alertPending, ""},
+			{5 * time.Minute, 57, alertFiring, alertFiring},
+			{6 * time.Minute, 40, alertOK, alertResolved},
+		}},
+		{"pending batal sebelum durasi", 300, []reading{
+			{0, 55, alertPending, ""},
+			{time.Minute, 45, alertOK, ""},
+			{2 * time.Minute, 55, alertPending, ""},
+			{6 * time.Minute, 55, alertPending, ""},
+			{7 * time.Minute, 55, alertFiring, alertFiring},
+		}},
+		{"data telat diabaikan", 0, []reading{
+			{time.Minute, 40, alertOK, ""},
+			{0, 99, alertOK, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &AlertRule{Operator: alertAbove, Threshold: 50, Hysteresis: 2, DurationSeconds: tt.duration, State: alertOK}
+			var firstBreach time.Time
+			for i, rd := range tt.readings {
+				at := base.Add(rd.at)
+				if rule.State == alertOK && rule.breached(rd.value) && !at.Before(rule.lastAt) {
+					firstBreach = at
+				}
+				before := rule.State
+				step := rule.step(liveReading{Value: rd.value, RecordedAt: at})
+				if rule.State != rd.state || step.Event != rd.event {
+					t.Fatalf("pembacaan %d: state %s event %q, want %s %q", i, rule.State, step.Event, rd.state, rd.event)
+				}
+				if step.Changed != (before != rule.State) {
+					t.Errorf("pembacaan %d: Changed = %v untuk %s -> %s", i, step.Changed, before, rule.State)
+				}
+				if step.Event != "" && !step.Since.Equal(firstBreach) {
+					t.Errorf("pembacaan %d: Since = %v, want %v", i, step.Since, firstBreach)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertRuleValidateHysteresis(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.WebhookSecret = "rahasia"
+	config.AlertWebhooks = []string{"http://127.0.0.1/hook"}
+
+	low, high := 20.0, 30.0
+	tests := []struct {
+		operator   string
+		hysteresis float64
+		wantErr    bool
+	}{
+		{alertOutside, 4.9, false},
+		{alertOutside, 5, true},
+		{alertOutside, 8, true},
+		{alertAbove, 50, false},
+	}
+	for _, tt := range tests {
+		req := alertRuleRequest{
+			DeviceUniqueID: "dev-1",
+			ParameterName:  "suhu",
+			Operator:       tt.operator,
+			Threshold:      &low,
+			ThresholdHigh:  &high,
+			Hysteresis:     tt.hysteresis,
+		}
+		if err := req.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s hysteresis %g: err = %v, wantErr %v", tt.operator, tt.hysteresis, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAlertEngineEvaluateQueuesChanges(t *testing.T) {
+	rule := &AlertRule{ID: 7, DeviceUniqueID: "dev-1", ParameterName: "suhu", Operator: alertAbove, Threshold: 50, State: alertOK}
+	e := &alertEngine{
+		rules: map[string][]*AlertRule{alertKey("dev-1", "suhu"): {rule}},
+		wake:  make(chan struct{}, 1),
+	}
+	base := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	e.evaluate([]liveReading{
+		{DeviceUniqueID: "dev-1", ParameterName: "suhu", Value: 40, RecordedAt: base},
+		{DeviceUniqueID: "dev-1", ParameterName: "suhu", Value: 55, RecordedAt: base.Add(time.Minute)},
+		{DeviceUniqueID: "dev-2", ParameterName: "suhu", Value: 99, RecordedAt: base.Add(time.Minute)},
+	})
+
+	if len(e.pending) != 1 {
+		t.Fatalf("pending = %d, want 1", len(e.pending))
+	}
+	c := e.pending[0]
+	if c.rule.ID != 7 || c.rule.State != alertFiring || c.step.Event != alertFiring || c.lr.Value != 55 {
+		t.Errorf("change = %+v", c)
+	}
+	select {
+	case <-e.wake:
+	default:
+		t.Error("writer tidak dibangunkan")
+	}
+
+	// Salinan tidak ikut berubah oleh transisi berikutnya
+	e.evaluate([]liveReading{{DeviceUniqueID: "dev-1", ParameterName: "suhu", Value: 10, RecordedAt: base.Add(2 * time.Minute)}})
+	if e.pending[0].rule.State != alertFiring || rule.State != alertOK {
+		t.Errorf("state salinan %s, rule %s", e.pending[0].rule.State, rule.State)
+	}
+}
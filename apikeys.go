@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const apiKeysSchema = `
+CREATE TABLE IF NOT EXISTS api_keys (
+	id              SERIAL PRIMARY KEY,
+	label           TEXT NOT NULL,
+	key_prefix      TEXT NOT NULL,
+	key_hash        TEXT NOT NULL UNIQUE,
+	scopes          TEXT[] NOT NULL DEFAULT '{read}',
+	device_patterns TEXT[] NOT NULL DEFAULT '{}',
+	device_groups   TEXT[] NOT NULL DEFAULT '{}',
+	expires_at      TIMESTAMPTZ,
+	revoked_at      TIMESTAMPTZ,
+	last_used_at    TIMESTAMPTZ,
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS device_groups (
+	group_name       TEXT NOT NULL,
+	device_unique_id TEXT NOT NULL,
+	PRIMARY KEY (group_name, device_unique_id)
+);
+`
+
+// Lama cache hasil lookup key yang valid; key tidak dikenal tidak di-cache
+const apiKeyCacheTTL = time.Minute
+
+type cachedKey struct {
+	identity *Identity
+	until    time.Time
+}
+
+var (
+	apiKeyCacheMu    sync.Mutex
+	apiKeyCache      = map[string]cachedKey{}
+	apiKeyCacheSwept time.Time
+)
+
+// Hash key API (key acak panjang, cukup SHA-256)
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Cari identitas key di tabel api_keys, dengan cache
+func lookupAPIKey(key string) *Identity {
+	hash := hashAPIKey(key)
+	now := time.Now()
+
+	apiKeyCacheMu.Lock()
+	if c, ok := apiKeyCache[hash]; ok && now.Before(c.until) {
+		apiKeyCacheMu.Unlock()
+		return c.identity
+	}
+	apiKeyCacheMu.Unlock()
+
+	identity, err := loadAPIKey(hash)
+	if err != nil {
+		// Jangan cache error database
+		log.Println("api key lookup:", err)
+		return nil
+	}
+	if identity == nil {
+		// Key tidak dikenal tidak di-cache: bearer acak tidak boleh memenuhi cache
+		return nil
+	}
+
+	until := now.Add(apiKeyCacheTTL)
+	if identity.ExpiresAt != nil && identity.ExpiresAt.Before(until) {
+		until = *identity.ExpiresAt
+	}
+	apiKeyCacheMu.Lock()
+	sweepAPIKeyCache(now)
+	apiKeyCache[hash] = cachedKey{identity: identity, until: until}
+	apiKeyCacheMu.Unlock()
+	return identity
+}
+
+// Buang entri cache yang sudah lewat, paling sering sekali per TTL (apiKeyCacheMu dipegang)
+func sweepAPIKeyCache(now time.Time) {
+	if now.Sub(apiKeyCacheSwept) < apiKeyCacheTTL {
+		return
+	}
+	for hash, c := range apiKeyCache {
+		if !now.Before(c.until) {
+			delete(apiKeyCache, hash)
+		}
+	}
+	apiKeyCacheSwept = now
+}
+
+// Hapus semua cache key (dipanggil setelah key diubah)
+func invalidateAPIKeyCache() {
+	apiKeyCacheMu.Lock()
+	apiKeyCache = map[string]cachedKey{}
+	apiKeyCacheMu.Unlock()
+}
+
+// Load key aktif dari database; nil jika tidak ada, expired atau dicabut
+func loadAPIKey(hash string) (*Identity, error) {
+	var (
+		id        int
+		label     string
+		scopes    []string
+		patterns  []string
+		groups    []string
+		expiresAt sql.NullTime
+	)
+	err := db.QueryRow(`
+		SELECT id, label, scopes, device_patterns, device_groups, expires_at
+		FROM api_keys
+		WHERE key_hash = $1
+		  AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > NOW())
+	`, hash).Scan(&id, &label, pq.Array(&scopes), pq.Array(&patterns), pq.Array(&groups), &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Name:           label,
+		KeyID:          id,
+		Scopes:         scopes,
+		DevicePatterns: patterns,
+		DeviceGroups:   groups,
+	}
+	if expiresAt.Valid {
+		identity.ExpiresAt = &expiresAt.Time
+	}
+
+	// Device dari grup di-resolve sekali saat key di-load
+	if len(groups) > 0 {
+		rows, err := db.Query(`
+			SELECT device_unique_id FROM device_groups WHERE group_name = ANY($1)
+		`, pq.Array(groups))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		identity.Devices = map[string]bool{}
+		for rows.Next() {
+			var deviceID string
+			if err := rows.Scan(&deviceID); err != nil {
+				continue
+			}
+			identity.Devices[deviceID] = true
+		}
+	}
+
+	return identity, nil
+}
+
+// Cek akses identitas ke satu device (pola glob atau anggota grup)
+func (id *Identity) CanAccessDevice(deviceID string) bool {
+	if id == nil {
+		return false
+	}
+	if id.AllDevices || id.Devices[deviceID] {
+		return true
+	}
+	for _, pattern := range id.DevicePatterns {
+		if ok, _ := path.Match(pattern, deviceID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Saring daftar device sesuai akses identitas
+func (id *Identity) FilterDevices(deviceIDs []string) []string {
+	allowed := []string{}
+	for _, d := range deviceIDs {
+		if id.CanAccessDevice(d) {
+			allowed = append(allowed, d)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Scope akses API
+const (
+	scopeAll    = "*"
+	scopeRead   = "read"
+	scopeExport = "export"
+	scopeIngest = "ingest"
+	scopeAdmin  = "admin"
+	scopeAlerts = "alerts"
+)
+
+// Identitas pemilik token yang sudah terautentikasi
+type Identity struct {
+	Name   string
+	KeyID  int // 0 untuk token statis dari config
+	Scopes []string
+
+	// Akses device: semua, pola glob device_unique_id, atau anggota grup
+	AllDevices     bool
+	DevicePatterns []string
+	DeviceGroups   []string
+	Devices        map[string]bool
+
+	ExpiresAt *time.Time
+}
+
+// Cek apakah identitas punya scope tertentu ("*" = semua scope)
+func (id *Identity) HasScope(scope string) bool {
+	if id == nil {
+		return false
+	}
+	for _, s := range id.Scopes {
+		if s == scopeAll || s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+const (
+	identityKey contextKey = iota
+	rateLimitKey
+)
+
+// Simpan identitas ke context request
+func withIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// Ambil identitas dari context request (nil jika belum login)
+func identityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey).(*Identity)
+	return id
+}
+
+// Middleware: tolak request jika token tidak punya scope yang diminta
+func requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !identityFromContext(r.Context()).HasScope(scope) {
+			respondError(w, "Token tidak punya akses "+scope, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Satu rantai auth untuk semua route data: CORS -> rate limit IP -> token -> rate limit key -> scope.
+// Limit per IP sebelum auth agar token asal-asalan tidak bebas memicu lookup key.
+func protected(scope string, h http.HandlerFunc) http.Handler {
+	return corsMiddleware(ipRateLimitMiddleware(authMiddleware(keyRateLimitMiddleware(requireScope(scope, h)))))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ukuran bucket yang didukung parameter interval
+var bucketIntervals = map[string]string{
+	"1m":  "1 minute",
+	"5m":  "5 minutes",
+	"15m": "15 minutes",
+	"1h":  "1 hour",
+	"6h":  "6 hours",
+	"1d":  "1 day",
+	"1w":  "1 week",
+}
+
+// Lebar tiap bucket, untuk membatasi jumlah bucket per request
+var bucketDurations = map[string]time.Duration{
+	"1 minute":   time.Minute,
+	"5 minutes":  5 * time.Minute,
+	"15 minutes": 15 * time.Minute,
+	"1 hour":     time.Hour,
+	"6 hours":    6 * time.Hour,
+	"1 day":      24 * time.Hour,
+	"1 week":     7 * 24 * time.Hour,
+}
+
+// Jumlah bucket maksimal per parameter dalam satu response ringkas
+const maxBuckets = 10000
+
+// Origin bucket: Senin 00:00 agar bucket mingguan mulai hari Senin
+const bucketOrigin = "TIMESTAMP '2000-01-03 00:00:00'"
+
+// Validasi parameter interval (kosong = pakai default per jam/per hari)
+func parseBucketInterval(interval string) (string, error) {
+	if interval == "" {
+		return "", nil
+	}
+	if pgInterval, ok := bucketIntervals[interval]; ok {
+		return pgInterval, nil
+	}
+	return "", fmt.Errorf("interval hanya 1m | 5m | 15m | 1h | 6h | 1d | 1w")
+}
+
+// Awal bucket selebar pgInterval dari bucketOrigin. Setara date_bin, yang baru ada
+// di PostgreSQL 14; hasilnya tetap timestamp tanpa zona seperti tzQuery.
+func bucketStart(pgInterval, tzQuery string) string {
+	seconds := int64(bucketDurations[pgInterval] / time.Second)
+	return fmt.Sprintf("(%[1]s + FLOOR(EXTRACT(EPOCH FROM (%[2]s - %[1]s)) / %[3]d)::bigint * INTERVAL '%[3]d seconds')",
+		bucketOrigin, tzQuery, seconds)
+}
+
+// Ekspresi GROUP BY dan label recorded_at untuk mode ringkas.
+// pgInterval kosong: default lama (DATE_TRUNC hour atau DATE per hari).
+func bucketColumns(pgInterval, defaultUnit, tzQuery string) (groupExpr, labelExpr string) {
+	if pgInterval != "" {
+		groupExpr = bucketStart(pgInterval, tzQuery)
+		return groupExpr, fmt.Sprintf("TO_CHAR(%s, 'YYYY-MM-DD HH24:MI:SS')", groupExpr)
+	}
+	if defaultUnit == "day" {
+		groupExpr = fmt.Sprintf("DATE(%s)", tzQuery)
+		return groupExpr, fmt.Sprintf("TO_CHAR(%s, 'YYYY-MM-DD')", groupExpr)
+	}
+	groupExpr = fmt.Sprintf("DATE_TRUNC('hour', %s)", tzQuery)
+	return groupExpr, fmt.Sprintf("TO_CHAR(%s, 'YYYY-MM-DD HH24:MI:SS')", groupExpr)
+}
+
+// Tolak kombinasi window dan interval yang menghasilkan terlalu banyak bucket
+func checkBucketCount(pgInterval string, from, to time.Time) error {
+	size, ok := bucketDurations[pgInterval]
+	if !ok {
+		return nil
+	}
+	if n := int64(to.Sub(from) / size); n > maxBuckets {
+		return fmt.Errorf("interval terlalu kecil untuk rentang ini (%d bucket, maksimal %d)", n, maxBuckets)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBucketInterval(t *testing.T) {
+	for interval, want := range bucketIntervals {
+		got, err := parseBucketInterval(interval)
+		if err != nil || got != want {
+			t.Errorf("parseBucketInterval(%q) = %q, %v", interval, got, err)
+		}
+		if _, ok := bucketDurations[got]; !ok {
+			t.Errorf("bucketDurations tidak punya %q", got)
+		}
+	}
+	if got, err := parseBucketInterval(""); got != "" || err != nil {
+		t.Errorf("interval kosong = %q, %v", got, err)
+	}
+	if _, err := parseBucketInterval("2m"); err == nil {
+		t.Error("interval tidak dikenal harus error")
+	}
+}
+
+func TestCheckBucketCount(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		interval string
+		span     time.Duration
+		wantErr  bool
+	}{
+		{"1 minute", day, false},
+		{"1 minute", 6 * day, false},
+		{"1 minute", 7 * day, true},
+		{"1 minute", 366 * day, true},
+		{"5 minutes", 31 * day, false},
+		{"15 minutes", 366 * day, true},
+		{"1 hour", 366 * day, false},
+		{"1 week", 366 * day, false},
+		{"", 366 * day, false},
+	}
+	for _, tt := range tests {
+		err := checkBucketCount(tt.interval, from, from.Add(tt.span))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkBucketCount(%q, %v) = %v, wantErr %v", tt.interval, tt.span, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBucketStart(t *testing.T) {
+	got := bucketStart("5 minutes", "l.recorded_at")
+	want := "(TIMESTAMP '2000-01-03 00:00:00' + FLOOR(EXTRACT(EPOCH FROM (l.recorded_at - TIMESTAMP '2000-01-03 00:00:00')) / 300)::bigint * INTERVAL '300 seconds')"
+	if got != want {
+		t.Errorf("bucketStart = %s\nwant %s", got, want)
+	}
+	if got := bucketStart("1 week", "x"); !strings.Contains(got, "/ 604800)") {
+		t.Errorf("bucketStart 1 week = %s", got)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Konfigurasi aplikasi: default < file YAML < environment variable
+type Config struct {
+	DatabaseDSN       string        `yaml:"database_dsn"`
+	DBMaxOpenConns    int           `yaml:"db_max_open_conns"`
+	DBMaxIdleConns    int           `yaml:"db_max_idle_conns"`
+	DBConnMaxLifetime time.Duration `yaml:"db_conn_max_lifetime"`
+	ListenAddr        string        `yaml:"listen_addr"`
+	APITokens         []APIToken    `yaml:"api_tokens"`
+	CORSOrigins       []string      `yaml:"cors_origins"`
+	DefaultTimezone   string        `yaml:"default_timezone"`
+
+	// Rate limit per API key dan per IP
+	RateLimitCheap     RateLimit `yaml:"rate_limit_cheap"`
+	RateLimitExpensive RateLimit `yaml:"rate_limit_expensive"`
+	TrustProxyHeaders  bool      `yaml:"trust_proxy_headers"`
+
+	// Webhook notifikasi (payload ditandatangani dengan WebhookSecret)
+	WebhookSecret string   `yaml:"webhook_secret"`
+	AlertWebhooks []string `yaml:"alert_webhooks"`
+
+	DeviceHealth DeviceHealthConfig `yaml:"device_health"`
+}
+
+// Token API statis. Di YAML boleh string biasa (semua scope, semua device)
+// atau objek {name, token, scopes, devices}.
+type APIToken struct {
+	Name    string   `yaml:"name"`
+	Token   string   `yaml:"token"`
+	Scopes  []string `yaml:"scopes"`
+	Devices []string `yaml:"devices"` // pola glob device_unique_id, kosong = semua
+}
+
+func (t *APIToken) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		t.Token = node.Value
+		return nil
+	}
+	type plain APIToken
+	return node.Decode((*plain)(t))
+}
+
+var config Config
+
+// Nilai default (tanpa secret)
+func defaultConfig() Config {
+	return Config{
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    5,
+		DBConnMaxLifetime: 5 * time.Minute,
+		ListenAddr:        ":8089",
+		CORSOrigins:       []string{"*"},
+		DefaultTimezone:   "wib",
+
+		RateLimitCheap:     RateLimit{PerMinute: 120, Burst: 60},
+		RateLimitExpensive: RateLimit{PerMinute: 6, Burst: 3},
+
+		DeviceHealth: DeviceHealthConfig{
+			DefaultInterval: 5 * time.Minute,
+			LateFactor:      2,
+			OfflineFactor:   6,
+			CheckInterval:   time.Minute,
+		},
+	}
+}
+
+// Load konfigurasi. Path file dari flag -config atau env TEMINS_CONFIG (opsional).
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+
+	path := os.Getenv("TEMINS_CONFIG")
+	flag.StringVar(&path, "config", path, "path file konfigurasi YAML")
+	flag.Parse()
+
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("gagal membaca config %s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("gagal parse config %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+
+	// Token tanpa scope mendapat akses penuh
+	for i := range cfg.APITokens {
+		if cfg.APITokens[i].Name == "" {
+			cfg.APITokens[i].Name = fmt.Sprintf("token-%d", i+1)
+		}
+		if len(cfg.APITokens[i].Scopes) == 0 {
+			cfg.APITokens[i].Scopes = []string{scopeAll}
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Override dari environment variable TEMINS_*
+func applyEnv(cfg *Config) error {
+	if v := os.Getenv("TEMINS_DATABASE_DSN"); v != "" {
+		cfg.DatabaseDSN = v
+	}
+	if v := os.Getenv("TEMINS_LISTEN_ADDR"); v != "" {
+		cfg.ListenAddr = v
+	}
+	if v := os.Getenv("TEMINS_API_TOKENS"); v != "" {
+		cfg.APITokens = nil
+		for _, token := range splitList(v) {
+			cfg.APITokens = append(cfg.APITokens, APIToken{Token: token})
+		}
+	}
+	if v := os.Getenv("TEMINS_CORS_ORIGINS"); v != "" {
+		cfg.CORSOrigins = splitList(v)
+	}
+	if v := os.Getenv("TEMINS_DEFAULT_TIMEZONE"); v != "" {
+		cfg.DefaultTimezone = v
+	}
+	if v := os.Getenv("TEMINS_WEBHOOK_SECRET"); v != "" {
+		cfg.WebhookSecret = v
+	}
+	if v := os.Getenv("TEMINS_ALERT_WEBHOOKS"); v != "" {
+		cfg.AlertWebhooks = splitList(v)
+	}
+	if v := os.Getenv("TEMINS_DEVICE_WEBHOOKS"); v != "" {
+		cfg.DeviceHealth.Webhooks = splitList(v)
+	}
+	if v := os.Getenv("TEMINS_DEVICE_DEFAULT_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TEMINS_DEVICE_DEFAULT_INTERVAL harus durasi (mis. 5m): %s", v)
+		}
+		cfg.DeviceHealth.DefaultInterval = d
+	}
+	for env, dst := range map[string]*int{
+		"TEMINS_DB_MAX_OPEN_CONNS": &cfg.DBMaxOpenConns,
+		"TEMINS_DB_MAX_IDLE_CONNS": &cfg.DBMaxIdleConns,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s harus angka: %s", env, v)
+			}
+			*dst = n
+		}
+	}
+	if v := os.Getenv("TEMINS_DB_CONN_MAX_LIFETIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TEMINS_DB_CONN_MAX_LIFETIME harus durasi (mis. 5m): %s", v)
+		}
+		cfg.DBConnMaxLifetime = d
+	}
+	return nil
+}
+
+// Server tidak boleh jalan tanpa secret wajib
+func (c Config) validate() error {
+	if c.DatabaseDSN == "" {
+		return fmt.Errorf("database_dsn / TEMINS_DATABASE_DSN wajib diisi")
+	}
+	if len(c.APITokens) == 0 {
+		return fmt.Errorf("api_tokens / TEMINS_API_TOKENS wajib diisi")
+	}
+	for _, t := range c.APITokens {
+		if t.Token == "" {
+			return fmt.Errorf("api_tokens tidak boleh berisi token kosong")
+		}
+	}
+	if c.DBMaxOpenConns <= 0 || c.DBMaxIdleConns < 0 {
+		return fmt.Errorf("ukuran pool database tidak valid")
+	}
+	for name, rl := range map[string]RateLimit{"rate_limit_cheap": c.RateLimitCheap, "rate_limit_expensive": c.RateLimitExpensive} {
+		if rl.PerMinute <= 0 || rl.Burst < 1 {
+			return fmt.Errorf("%s: per_minute harus > 0 dan burst >= 1", name)
+		}
+	}
+	if (len(c.AlertWebhooks) > 0 || len(c.DeviceHealth.Webhooks) > 0) && c.WebhookSecret == "" {
+		return fmt.Errorf("webhook_secret / TEMINS_WEBHOOK_SECRET wajib diisi jika webhook dipakai")
+	}
+	for _, u := range c.AlertWebhooks {
+		if err := validateWebhookURL(u); err != nil {
+			return fmt.Errorf("alert_webhooks: %w", err)
+		}
+	}
+	if err := c.DeviceHealth.validate(); err != nil {
+		return err
+	}
+	if _, err := resolveZona(c.DefaultTimezone); err != nil {
+		return fmt.Errorf("default_timezone: %w", err)
+	}
+	return nil
+}
+
+// Log konfigurasi efektif dengan secret disamarkan
+func (c Config) logRedacted() {
+	tokens := make([]string, len(c.APITokens))
+	for i, t := range c.APITokens {
+		tokens[i] = fmt.Sprintf("%s=%s%v", t.Name, redactSecret(t.Token), t.Scopes)
+	}
+	log.Printf("⚙️  Config: dsn=%q pool=%d/%d lifetime=%s listen=%s tokens=%v cors=%v timezone=%s rate=%v/%v proxy=%t webhook_secret=%s alert_webhooks=%v device_health=%s/%v",
+		redactDSN(c.DatabaseDSN), c.DBMaxOpenConns, c.DBMaxIdleConns, c.DBConnMaxLifetime,
+		c.ListenAddr, tokens, c.CORSOrigins, c.DefaultTimezone,
+		c.RateLimitCheap, c.RateLimitExpensive, c.TrustProxyHeaders,
+		redactSecret(c.WebhookSecret), c.AlertWebhooks, c.DeviceHealth.DefaultInterval, c.DeviceHealth.Webhooks)
+}
+
+var dsnPasswordPattern = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// Samarkan password di DSN (format URL maupun key=value)
+func redactDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			return u.Redacted()
+		}
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+// Tampilkan 4 karakter awal saja
+func redactSecret(s string) string {
+	if len(s) <= 4 {
+		return "****"
+	}
+	return s[:4] + "****"
+}
+
+// Pisah daftar dipisah koma, buang item kosong
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const deviceStatusSchema = `
+CREATE TABLE IF NOT EXISTS device_status (
+	device_unique_id TEXT PRIMARY KEY,
+	status           TEXT NOT NULL,
+	last_seen        TIMESTAMP,
+	changed_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+`
+
+// Status device berdasarkan umur pembacaan terakhir
+const (
+	deviceOnline  = "online"
+	deviceLate    = "late"
+	deviceOffline = "offline"
+)
+
+// Konfigurasi deteksi device mati. Device dianggap late setelah
+// LateFactor x interval tanpa data dan offline setelah OfflineFactor x interval.
+type DeviceHealthConfig struct {
+	DefaultInterval time.Duration    `yaml:"default_interval"`
+	LateFactor      float64          `yaml:"late_factor"`
+	OfflineFactor   float64          `yaml:"offline_factor"`
+	CheckInterval   time.Duration    `yaml:"check_interval"`
+	Intervals       []DeviceInterval `yaml:"intervals"`
+	Webhooks        []string         `yaml:"webhooks"`
+}
+
+// Interval lapor per device (pola glob, entri pertama yang cocok dipakai)
+type DeviceInterval struct {
+	Devices  string        `yaml:"devices"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Interval lapor yang diharapkan untuk satu device
+func (c DeviceHealthConfig) intervalFor(deviceID string) time.Duration {
+	for _, di := range c.Intervals {
+		if ok, _ := path.Match(di.Devices, deviceID); ok {
+			return di.Interval
+		}
+	}
+	return c.DefaultInterval
+}
+
+// Klasifikasi umur data terhadap interval lapor
+func (c DeviceHealthConfig) classify(age, interval time.Duration) string {
+	switch {
+	case age <= time.Duration(c.LateFactor*float64(interval)):
+		return deviceOnline
+	case age <= time.Duration(c.OfflineFactor*float64(interval)):
+		return deviceLate
+	default:
+		return deviceOffline
+	}
+}
+
+func (c DeviceHealthConfig) validate() error {
+	if c.DefaultInterval <= 0 || c.CheckInterval <= 0 {
+		return fmt.Errorf("device_health: default_interval dan check_interval harus > 0")
+	}
+	if c.LateFactor < 1 || c.OfflineFactor <= c.LateFactor {
+		return fmt.Errorf("device_health: harus 1 <= late_factor < offline_factor")
+	}
+	for _, di := range c.Intervals {
+		if _, err := path.Match(di.Devices, ""); err != nil || di.Interval <= 0 {
+			return fmt.Errorf("device_health.intervals: pola %q atau interval tidak valid", di.Devices)
+		}
+	}
+	for _, u := range c.Webhooks {
+		if err := validateWebhookURL(u); err != nil {
+			return fmt.Errorf("device_health.webhooks: %w", err)
+		}
+	}
+	return nil
+}
+
+// Kesehatan satu device
+type DeviceHealth struct {
+	DeviceUniqueID          string  `json:"device_unique_id"`
+	Status                  string  `json:"status"`
+	LastSeen                string  `json:"last_seen"`
+	SecondsSinceLastSeen    int64   `json:"seconds_since_last_seen"`
+	SinceLastSeen           string  `json:"since_last_seen"`
+	ExpectedIntervalSeconds float64 `json:"expected_interval_seconds"`
+
+	lastSeen time.Time // WIB tanpa zona, seperti recorded_at
+}
+
+// Payload webhook perubahan status device
+type DeviceStatusEvent struct {
+	DeviceUniqueID          string  `json:"device_unique_id"`
+	From                    string  `json:"from"`
+	To                      string  `json:"to"`
+	LastSeen                string  `json:"last_seen"`
+	SecondsSinceLastSeen    int64   `json:"seconds_since_last_seen"`
+	ExpectedIntervalSeconds float64 `json:"expected_interval_seconds"`
+	Timezone                string  `json:"timezone"`
+}
+
+// Pembacaan terakhir per device. Tanpa filter, daftar device diambil
+// dengan loose index scan agar tidak perlu DISTINCT atas seluruh sensor_logs.
+func fetchLastSeen(deviceIDs []string) ([]DeviceHealth, error) {
+	devicesCTE := `SELECT device_unique_id FROM unnest($1::text[]) AS d(device_unique_id)`
+	args := []interface{}{pq.Array(deviceIDs)}
+	if len(deviceIDs) == 0 {
+		devicesCTE = `
+			WITH RECURSIVE d(device_unique_id) AS (
+				(SELECT device_unique_id FROM sensor_logs ORDER BY device_unique_id LIMIT 1)
+				UNION ALL
+				SELECT (
+					SELECT s.device_unique_id FROM sensor_logs s
+					WHERE s.device_unique_id > d.device_unique_id
+					ORDER BY s.device_unique_id LIMIT 1
+				)
+				FROM d WHERE d.device_unique_id IS NOT NULL
+			)
+			SELECT device_unique_id FROM d WHERE device_unique_id IS NOT NULL`
+		args = nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT d.device_unique_id, s.recorded_at
+		FROM (%s) d
+		JOIN LATERAL (
+			SELECT recorded_at
+			FROM sensor_logs
+			WHERE device_unique_id = d.device_unique_id
+			ORDER BY recorded_at DESC
+			LIMIT 1
+		) s ON true
+		ORDER BY d.device_unique_id
+	`, devicesCTE), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []DeviceHealth
+	for rows.Next() {
+		var h DeviceHealth
+		if err := rows.Scan(&h.DeviceUniqueID, &h.lastSeen); err != nil {
+			continue
+		}
+		devices = append(devices, h)
+	}
+	return devices, nil
+}
+
+// Isi status dan umur data relatif terhadap now
+func (h *DeviceHealth) evaluate(now time.Time, zona Zona) {
+	interval := config.DeviceHealth.intervalFor(h.DeviceUniqueID)
+	lastSeen := zona.FromDatabase(h.lastSeen)
+	age := now.Sub(lastSeen)
+	if age < 0 {
+		age = 0
+	}
+	h.Status = config.DeviceHealth.classify(age, interval)
+	h.LastSeen = lastSeen.Format("2006-01-02 15:04:05")
+	h.SecondsSinceLastSeen = int64(age.Seconds())
+	h.SinceLastSeen = age.Truncate(time.Second).String()
+	h.ExpectedIntervalSeconds = interval.Seconds()
+}
+
+// Handler: GET /api/devices/health?device_id=a,b&status=offline
+func deviceHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method harus GET", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+
+	zona, err := resolveZona(q.Get("zonawaktu"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status := q.Get("status")
+	if status != "" && status != deviceOnline && status != deviceLate && status != deviceOffline {
+		respondError(w, "status harus online, late atau offline", http.StatusBadRequest)
+		return
+	}
+
+	identity := identityFromContext(r.Context())
+	requested := splitList(q.Get("device_id"))
+	if len(requested) > 0 {
+		requested = identity.FilterDevices(requested)
+		if len(requested) == 0 {
+			respondError(w, "Token tidak punya akses ke device ini", http.StatusForbidden)
+			return
+		}
+	}
+
+	devices, err := fetchLastSeen(requested)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	counts := map[string]int{}
+	data := []DeviceHealth{}
+	for _, h := range devices {
+		if !identity.CanAccessDevice(h.DeviceUniqueID) {
+			continue
+		}
+		h.evaluate(now, zona)
+		counts[h.Status]++
+		if status == "" || h.Status == status {
+			data = append(data, h)
+		}
+	}
+
+	respond(w, Response{
+		Status:   true,
+		Filter:   "device_health",
+		Mode:     "health",
+		Timezone: zona.Label,
+		DeviceID: strings.Join(requested, ","),
+		Total:    len(data),
+		Data:     data,
+		Message: fmt.Sprintf("online=%d late=%d offline=%d",
+			counts[deviceOnline], counts[deviceLate], counts[deviceOffline]),
+	})
+}
+
+// Worker: cek status semua device berkala dan kirim webhook saat status berubah.
+// Status terakhir disimpan di device_status agar restart tidak mengirim ulang.
+func deviceHealthWorker() {
+	ticker := time.NewTicker(config.DeviceHealth.CheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := checkDeviceHealth(); err != nil {
+			log.Println("device health:", err)
+		}
+		<-ticker.C
+	}
+}
+
+func checkDeviceHealth() error {
+	devices, err := fetchLastSeen(nil)
+	if err != nil {
+		return err
+	}
+
+	previous := map[string]string{}
+	rows, err := db.Query(`SELECT device_unique_id, status FROM device_status`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, status string
+		if err := rows.Scan(&id, &status); err == nil {
+			previous[id] = status
+		}
+	}
+	rows.Close()
+
+	zona, _ := resolveZona("")
+	now := time.Now()
+	for _, h := range devices {
+		h.evaluate(now, zona)
+		before, known := previous[h.DeviceUniqueID]
+		if known && before == h.Status {
+			continue
+		}
+
+		if _, err := db.Exec(`
+			INSERT INTO device_status (device_unique_id, status, last_seen, changed_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (device_unique_id) DO UPDATE
+			SET status = EXCLUDED.status, last_seen = EXCLUDED.last_seen, changed_at = NOW()
+		`, h.DeviceUniqueID, h.Status, h.lastSeen); err != nil {
+			log.Println("device health:", err)
+			continue
+		}
+
+		// Device baru dicatat tanpa notifikasi
+		if !known {
+			continue
+		}
+		log.Printf("📡 Device %s: %s -> %s (terakhir %s)", h.DeviceUniqueID, before, h.Status, h.LastSeen)
+		enqueueWebhook(config.DeviceHealth.Webhooks, "device.status", DeviceStatusEvent{
+			DeviceUniqueID:          h.DeviceUniqueID,
+			From:                    before,
+			To:                      h.Status,
+			LastSeen:                h.LastSeen,
+			SecondsSinceLastSeen:    h.SecondsSinceLastSeen,
+			ExpectedIntervalSeconds: h.ExpectedIntervalSeconds,
+			Timezone:                zona.Label,
+		})
+	}
+	return nil
+}
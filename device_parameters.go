@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Ringkasan per device/parameter, dirawat trigger statement-level di sensor_logs
+// (satu upsert per pasangan per INSERT/COPY, bukan per baris).
+// Baris yang dihapus/diubah di sensor_logs tidak mengurangi sample_count.
+var parameterStatsSchema = `
+CREATE TABLE IF NOT EXISTS device_parameter_stats (
+	device_unique_id TEXT NOT NULL,
+	parameter_name   TEXT NOT NULL,
+	first_seen       TIMESTAMP NOT NULL,
+	last_seen        TIMESTAMP NOT NULL,
+	sample_count     BIGINT NOT NULL,
+	last_value       DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY (device_unique_id, parameter_name)
+);
+CREATE OR REPLACE FUNCTION update_device_parameter_stats() RETURNS trigger AS $$
+BEGIN
+	` + fmt.Sprintf(parameterStatsUpsert, "new_rows") + `;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+`
+
+// Gabungkan ringkasan sekumpulan baris ke device_parameter_stats.
+// Penggabungan bersifat aditif, jadi bisa dipakai trigger maupun pengisian awal per batch.
+const parameterStatsUpsert = `INSERT INTO device_parameter_stats AS s
+		(device_unique_id, parameter_name, first_seen, last_seen, sample_count, last_value)
+	SELECT DISTINCT ON (device_unique_id, parameter_name)
+		device_unique_id, parameter_name,
+		MIN(recorded_at) OVER w, MAX(recorded_at) OVER w, COUNT(*) OVER w, value
+	FROM %s
+	WINDOW w AS (PARTITION BY device_unique_id, parameter_name)
+	ORDER BY device_unique_id, parameter_name, recorded_at DESC, id DESC
+	ON CONFLICT (device_unique_id, parameter_name) DO UPDATE SET
+		first_seen   = LEAST(s.first_seen, EXCLUDED.first_seen),
+		last_seen    = GREATEST(s.last_seen, EXCLUDED.last_seen),
+		sample_count = s.sample_count + EXCLUDED.sample_count,
+		last_value   = CASE WHEN EXCLUDED.last_seen >= s.last_seen THEN EXCLUDED.last_value ELSE s.last_value END`
+
+// Kosongkan ringkasan dan pasang trigger, lalu isi dari data lama per batch id
+func seedParameterStats() error {
+	return installSensorTrigger(sensorTrigger{
+		name:  "sensor_logs_parameter_stats",
+		setup: []string{`TRUNCATE device_parameter_stats`},
+		create: `CREATE TRIGGER sensor_logs_parameter_stats
+			AFTER INSERT ON sensor_logs
+			REFERENCING NEW TABLE AS new_rows
+			FOR EACH STATEMENT EXECUTE FUNCTION update_device_parameter_stats()`,
+		backfill: fmt.Sprintf(parameterStatsUpsert, "(SELECT * FROM sensor_logs WHERE id > $1 AND id <= $2) AS l"),
+	})
+}
+
+// Parameter yang benar-benar dilaporkan device
+type DeviceParameter struct {
+	ParameterName string   `json:"parameter_name"`
+	Label         string   `json:"label,omitempty"`
+	Unit          string   `json:"unit,omitempty"`
+	FirstSeen     string   `json:"first_seen"`
+	LastSeen      string   `json:"last_seen"`
+	Count         int64    `json:"count"`
+	LatestValue   float64  `json:"latest_value"`
+	Precision     *int     `json:"precision,omitempty"`
+	MinValue      *float64 `json:"min_value,omitempty"`
+	MaxValue      *float64 `json:"max_value,omitempty"`
+}
+
+// Handler: GET /api/devices/{id}/parameters
+func deviceParameters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method harus GET", http.StatusMethodNotAllowed)
+		return
+	}
+	deviceID := r.PathValue("id")
+	if !identityFromContext(r.Context()).CanAccessDevice(deviceID) {
+		respondError(w, "Token tidak punya akses ke device ini", http.StatusForbidden)
+		return
+	}
+	zona, err := resolveZona(r.URL.Query().Get("zonawaktu"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT parameter_name, first_seen, last_seen, sample_count, last_value
+		FROM device_parameter_stats
+		WHERE device_unique_id = $1
+		ORDER BY parameter_name
+	`, deviceID)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	device, err := loadDevice(deviceID)
+	if err != nil {
+		log.Println("catalogue device:", err)
+	}
+
+	params := []DeviceParameter{}
+	for rows.Next() {
+		var p DeviceParameter
+		var firstSeen, lastSeen time.Time
+		if err := rows.Scan(&p.ParameterName, &firstSeen, &lastSeen, &p.Count, &p.LatestValue); err != nil {
+			continue
+		}
+		p.FirstSeen = zona.FromDatabase(firstSeen).Format("2006-01-02 15:04:05")
+		p.LastSeen = zona.FromDatabase(lastSeen).Format("2006-01-02 15:04:05")
+		if info := device.parameter(p.ParameterName); info != nil {
+			p.Label, p.Unit, p.Precision = info.Label, info.Unit, info.Precision
+			p.MinValue, p.MaxValue = info.MinValue, info.MaxValue
+		}
+		params = append(params, p)
+	}
+
+	respond(w, Response{
+		Status:   true,
+		Filter:   "device_parameters",
+		Mode:     "discovery",
+		Timezone: zona.Label,
+		DeviceID: deviceID,
+		Total:    len(params),
+		Data:     params,
+	})
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const devicesSchema = `
+CREATE TABLE IF NOT EXISTS devices (
+	device_unique_id TEXT PRIMARY KEY,
+	name             TEXT NOT NULL DEFAULT '',
+	site             TEXT NOT NULL DEFAULT '',
+	latitude         DOUBLE PRECISION,
+	longitude        DOUBLE PRECISION,
+	installed_at     DATE,
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS device_parameters (
+	device_unique_id TEXT NOT NULL REFERENCES devices (device_unique_id) ON DELETE CASCADE,
+	parameter_name   TEXT NOT NULL,
+	label            TEXT NOT NULL DEFAULT '',
+	unit             TEXT NOT NULL DEFAULT '',
+	precision        INTEGER,
+	min_value        DOUBLE PRECISION,
+	max_value        DOUBLE PRECISION,
+	PRIMARY KEY (device_unique_id, parameter_name)
+);
+`
+
+// Data device di catalogue
+type DeviceInfo struct {
+	DeviceUniqueID string          `json:"device_unique_id"`
+	Name           string          `json:"name"`
+	Site           string          `json:"site"`
+	Latitude       *float64        `json:"latitude"`
+	Longitude      *float64        `json:"longitude"`
+	InstalledAt    *string         `json:"installed_at"` // YYYY-MM-DD
+	Parameters     []ParameterInfo `json:"parameters"`
+	CreatedAt      string          `json:"created_at,omitempty"`
+	UpdatedAt      string          `json:"updated_at,omitempty"`
+}
+
+// Catalogue satu parameter: label tampilan, satuan, presisi dan rentang valid
+type ParameterInfo struct {
+	ParameterName string   `json:"parameter_name"`
+	Label         string   `json:"label"`
+	Unit          string   `json:"unit"`
+	Precision     *int     `json:"precision"`
+	MinValue      *float64 `json:"min_value"`
+	MaxValue      *float64 `json:"max_value"`
+}
+
+// Cari parameter di catalogue device (nil jika tidak ada)
+func (d *DeviceInfo) parameter(name string) *ParameterInfo {
+	if d == nil {
+		return nil
+	}
+	for i := range d.Parameters {
+		if d.Parameters[i].ParameterName == name {
+			return &d.Parameters[i]
+		}
+	}
+	return nil
+}
+
+// Label kolom: "Label (unit)", atau kode parameter huruf besar jika belum ada di catalogue
+func (p *ParameterInfo) columnLabel() string {
+	label := p.Label
+	if label == "" {
+		label = strings.ToUpper(p.ParameterName)
+	}
+	if p.Unit != "" {
+		label = fmt.Sprintf("%s (%s)", label, p.Unit)
+	}
+	return label
+}
+
+func (p *ParameterInfo) validate() error {
+	if p.ParameterName == "" {
+		return fmt.Errorf("parameter_name wajib diisi")
+	}
+	if p.Precision != nil && (*p.Precision < 0 || *p.Precision > 10) {
+		return fmt.Errorf("precision %s harus 0-10", p.ParameterName)
+	}
+	if p.MinValue != nil && p.MaxValue != nil && *p.MinValue > *p.MaxValue {
+		return fmt.Errorf("min_value %s lebih besar dari max_value", p.ParameterName)
+	}
+	return nil
+}
+
+func (d *DeviceInfo) validate() error {
+	if d.DeviceUniqueID == "" {
+		return fmt.Errorf("device_unique_id wajib diisi")
+	}
+	if (d.Latitude == nil) != (d.Longitude == nil) {
+		return fmt.Errorf("latitude dan longitude harus diisi bersamaan")
+	}
+	if d.Latitude != nil && (*d.Latitude < -90 || *d.Latitude > 90 || *d.Longitude < -180 || *d.Longitude > 180) {
+		return fmt.Errorf("koordinat tidak valid")
+	}
+	if d.InstalledAt != nil {
+		if _, err := time.Parse("2006-01-02", *d.InstalledAt); err != nil {
+			return fmt.Errorf("installed_at harus YYYY-MM-DD")
+		}
+	}
+	seen := map[string]bool{}
+	for i := range d.Parameters {
+		if err := d.Parameters[i].validate(); err != nil {
+			return err
+		}
+		if seen[d.Parameters[i].ParameterName] {
+			return fmt.Errorf("parameter %s duplikat", d.Parameters[i].ParameterName)
+		}
+		seen[d.Parameters[i].ParameterName] = true
+	}
+	return nil
+}
+
+// Ambil catalogue beberapa device (device yang belum terdaftar tidak ada di map).
+// deviceIDs kosong = semua device.
+func loadCatalog(deviceIDs []string) (map[string]*DeviceInfo, error) {
+	var filter interface{}
+	if len(deviceIDs) > 0 {
+		filter = pq.Array(deviceIDs)
+	}
+
+	rows, err := db.Query(`
+		SELECT device_unique_id, name, site, latitude, longitude,
+			TO_CHAR(installed_at, 'YYYY-MM-DD'), created_at, updated_at
+		FROM devices
+		WHERE $1::text[] IS NULL OR device_unique_id = ANY($1)
+		ORDER BY device_unique_id
+	`, filter)
+	if err != nil {
+		return nil, err
+	}
+	catalog := map[string]*DeviceInfo{}
+	for rows.Next() {
+		d := &DeviceInfo{Parameters: []ParameterInfo{}}
+		var lat, lon sql.NullFloat64
+		var installedAt sql.NullString
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&d.DeviceUniqueID, &d.Name, &d.Site, &lat, &lon, &installedAt, &createdAt, &updatedAt); err != nil {
+			continue
+		}
+		if lat.Valid && lon.Valid {
+			d.Latitude, d.Longitude = &lat.Float64, &lon.Float64
+		}
+		if installedAt.Valid {
+			d.InstalledAt = &installedAt.String
+		}
+		d.CreatedAt = createdAt.Format(time.RFC3339)
+		d.UpdatedAt = updatedAt.Format(time.RFC3339)
+		catalog[d.DeviceUniqueID] = d
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT device_unique_id, parameter_name, label, unit, precision, min_value, max_value
+		FROM device_parameters
+		WHERE $1::text[] IS NULL OR device_unique_id = ANY($1)
+		ORDER BY device_unique_id, parameter_name
+	`, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var deviceID string
+		var p ParameterInfo
+		var precision sql.NullInt64
+		var minValue, maxValue sql.NullFloat64
+		if err := rows.Scan(&deviceID, &p.ParameterName, &p.Label, &p.Unit, &precision, &minValue, &maxValue); err != nil {
+			continue
+		}
+		if precision.Valid {
+			n := int(precision.Int64)
+			p.Precision = &n
+		}
+		if minValue.Valid {
+			p.MinValue = &minValue.Float64
+		}
+		if maxValue.Valid {
+			p.MaxValue = &maxValue.Float64
+		}
+		if d := catalog[deviceID]; d != nil {
+			d.Parameters = append(d.Parameters, p)
+		}
+	}
+	return catalog, nil
+}
+
+// Catalogue satu device (nil jika belum terdaftar)
+func loadDevice(deviceID string) (*DeviceInfo, error) {
+	catalog, err := loadCatalog([]string{deviceID})
+	if err != nil {
+		return nil, err
+	}
+	return catalog[deviceID], nil
+}
+
+// Tulis parameter catalogue device (menimpa yang sudah ada)
+func upsertParameters(tx *sql.Tx, deviceID string, params []ParameterInfo) error {
+	for _, p := range params {
+		_, err := tx.Exec(`
+			INSERT INTO device_parameters (device_unique_id, parameter_name, label, unit, precision, min_value, max_value)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (device_unique_id, parameter_name) DO UPDATE
+			SET label = EXCLUDED.label, unit = EXCLUDED.unit, precision = EXCLUDED.precision,
+				min_value = EXCLUDED.min_value, max_value = EXCLUDED.max_value
+		`, deviceID, p.ParameterName, p.Label, p.Unit, p.Precision, p.MinValue, p.MaxValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ubah catalogue hanya untuk token dengan scope admin
+func requireAdminScope(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet {
+		return true
+	}
+	if !identityFromContext(r.Context()).HasScope(scopeAdmin) {
+		respondError(w, "Token tidak punya akses "+scopeAdmin, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Catalogue device yang diminta untuk Response get-data (deviceIDs dipisah koma).
+// Hanya dipanggil saat menyusun response sukses; nil jika tidak ada yang terdaftar.
+func deviceCatalog(deviceIDs string) map[string]*DeviceInfo {
+	catalog, err := loadCatalog(strings.Split(deviceIDs, ","))
+	if err != nil || len(catalog) == 0 {
+		return nil
+	}
+	return catalog
+}
+
+// Handler: /api/devices (GET list, POST create)
+func devicesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminScope(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		catalog, err := loadCatalog(nil)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		identity := identityFromContext(r.Context())
+		devices := []*DeviceInfo{}
+		for _, d := range catalog {
+			if identity.CanAccessDevice(d.DeviceUniqueID) {
+				devices = append(devices, d)
+			}
+		}
+		sort.Slice(devices, func(i, j int) bool {
+			return devices[i].DeviceUniqueID < devices[j].DeviceUniqueID
+		})
+		respond(w, Response{Status: true, Filter: "devices", Mode: "list", Total: len(devices), Data: devices})
+	case http.MethodPost:
+		var req DeviceInfo
+		if !decodeDevice(w, r, &req) {
+			return
+		}
+		saveDevice(w, "create", req, true)
+	default:
+		respondError(w, "method harus GET atau POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handler: /api/devices/{id} (GET detail, PUT ganti, DELETE hapus)
+// PUT tanpa field parameters tidak mengubah catalogue parameter.
+func deviceHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminScope(w, r) {
+		return
+	}
+	deviceID := r.PathValue("id")
+	if !identityFromContext(r.Context()).CanAccessDevice(deviceID) {
+		respondError(w, "Token tidak punya akses ke device ini", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondDevice(w, "detail", deviceID)
+	case http.MethodPut:
+		var req DeviceInfo
+		if !decodeDevice(w, r, &req) {
+			return
+		}
+		if req.DeviceUniqueID != deviceID {
+			respondError(w, "device_unique_id tidak sama dengan path", http.StatusBadRequest)
+			return
+		}
+		saveDevice(w, "update", req, false)
+	case http.MethodDelete:
+		res, err := db.Exec(`DELETE FROM devices WHERE device_unique_id = $1`, deviceID)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			respondError(w, "device tidak ditemukan", http.StatusNotFound)
+			return
+		}
+		respond(w, Response{Status: true, Filter: "devices", Mode: "delete", DeviceID: deviceID, Total: 1})
+	default:
+		respondError(w, "method harus GET, PUT atau DELETE", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handler: /api/devices/{id}/parameters/{param} (PUT upsert, DELETE hapus)
+func deviceParameterHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminScope(w, r) {
+		return
+	}
+	deviceID, param := r.PathValue("id"), r.PathValue("param")
+	if !identityFromContext(r.Context()).CanAccessDevice(deviceID) {
+		respondError(w, "Token tidak punya akses ke device ini", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var p ParameterInfo
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			respondError(w, "JSON tidak valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.ParameterName = param
+		if err := p.validate(); err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM devices WHERE device_unique_id = $1)`, deviceID).Scan(&exists); err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			respondError(w, "device tidak ditemukan", http.StatusNotFound)
+			return
+		}
+		if err := upsertParameters(tx, deviceID, []ParameterInfo{p}); err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondDevice(w, "parameter", deviceID)
+	case http.MethodDelete:
+		res, err := db.Exec(`DELETE FROM device_parameters WHERE device_unique_id = $1 AND parameter_name = $2`, deviceID, param)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			respondError(w, "parameter tidak ditemukan", http.StatusNotFound)
+			return
+		}
+		respondDevice(w, "parameter", deviceID)
+	default:
+		respondError(w, "method harus PUT atau DELETE", http.StatusMethodNotAllowed)
+	}
+}
+
+// Decode dan validasi body device; tulis error jika gagal
+func decodeDevice(w http.ResponseWriter, r *http.Request, req *DeviceInfo) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		respondError(w, "JSON tidak valid: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := req.validate(); err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if !identityFromContext(r.Context()).CanAccessDevice(req.DeviceUniqueID) {
+		respondError(w, "Token tidak punya akses ke device ini", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Simpan device (dan parameter jika dikirim) dalam satu transaksi
+func saveDevice(w http.ResponseWriter, mode string, req DeviceInfo, create bool) {
+	tx, err := db.Begin()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var res sql.Result
+	if create {
+		res, err = tx.Exec(`
+			INSERT INTO devices (device_unique_id, name, site, latitude, longitude, installed_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (device_unique_id) DO NOTHING
+		`, req.DeviceUniqueID, req.Name, req.Site, req.Latitude, req.Longitude, req.InstalledAt)
+	} else {
+		res, err = tx.Exec(`
+			UPDATE devices SET name = $2, site = $3, latitude = $4, longitude = $5, installed_at = $6, updated_at = NOW()
+			WHERE device_unique_id = $1
+		`, req.DeviceUniqueID, req.Name, req.Site, req.Latitude, req.Longitude, req.InstalledAt)
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if create {
+			respondError(w, "device sudah terdaftar", http.StatusConflict)
+		} else {
+			respondError(w, "device tidak ditemukan", http.StatusNotFound)
+		}
+		return
+	}
+
+	if req.Parameters != nil {
+		names := make([]string, len(req.Parameters))
+		for i, p := range req.Parameters {
+			names[i] = p.ParameterName
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM device_parameters WHERE device_unique_id = $1 AND NOT parameter_name = ANY($2)
+		`, req.DeviceUniqueID, pq.Array(names)); err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := upsertParameters(tx, req.DeviceUniqueID, req.Parameters); err != nil {
+			respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondDevice(w, mode, req.DeviceUniqueID)
+}
+
+// Kirim catalogue satu device sebagai response
+func respondDevice(w http.ResponseWriter, mode, deviceID string) {
+	d, err := loadDevice(deviceID)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if d == nil {
+		respondError(w, "device tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	respond(w, Response{Status: true, Filter: "devices", Mode: mode, DeviceID: deviceID, Total: 1, Data: d})
+}
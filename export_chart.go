@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Jarak baris antar grafik di sheet grafik (tinggi grafik 400px)
+const chartRowSpacing = 22
+
+// Satuan kolom: dari catalogue, atau teks dalam kurung terakhir di label (sensor_meta)
+func (c sensorColumn) unit() string {
+	if c.Unit != "" {
+		return c.Unit
+	}
+	if i := strings.LastIndex(c.Label, "("); i >= 0 && strings.HasSuffix(c.Label, ")") {
+		return strings.TrimSpace(c.Label[i+1 : len(c.Label)-1])
+	}
+	return ""
+}
+
+// Referensi sel/range absolut untuk formula chart; nama sheet selalu dikutip
+func sheetRef(sheet string, col, fromRow, toRow int) string {
+	name, _ := excelize.ColumnNumberToName(col)
+	ref := fmt.Sprintf("'%s'!$%s$%d", strings.ReplaceAll(sheet, "'", "''"), name, fromRow)
+	if toRow != fromRow {
+		ref += fmt.Sprintf(":$%s$%d", name, toRow)
+	}
+	return ref
+}
+
+// Kelompok kolom per grafik sesuai chart_split: "sensor" satu grafik per kolom,
+// "unit" satu grafik per satuan (urut kemunculan), selain itu satu grafik untuk semua
+func chartGroups(columns []sensorColumn, split string) [][]int {
+	var groups [][]int
+	switch split {
+	case "sensor":
+		for i := range columns {
+			groups = append(groups, []int{i})
+		}
+	case "unit":
+		index := map[string]int{}
+		for i, c := range columns {
+			g, ok := index[c.unit()]
+			if !ok {
+				g = len(groups)
+				index[c.unit()] = g
+				groups = append(groups, nil)
+			}
+			groups[g] = append(groups[g], i)
+		}
+	default:
+		group := make([]int, len(columns))
+		for i := range columns {
+			group[i] = i
+		}
+		groups = [][]int{group}
+	}
+	return groups
+}
+
+// Sheet grafik garis untuk satu sheet data: satu series per sensor terhadap kolom waktu.
+// Layout sheet data: A = No, kolom sensor mulai B, kolom waktu terakhir, data mulai baris 2.
+func addLineCharts(f *excelize.File, dataSheet, chartSheet string, e exportRequest, columns []sensorColumn, rows int) error {
+	if _, err := f.NewSheet(chartSheet); err != nil {
+		return err
+	}
+
+	lastRow := rows + 1
+	categories := sheetRef(dataSheet, len(columns)+2, 2, lastRow)
+	// Label waktu dijarangkan agar sumbu X tetap terbaca
+	skip := max(rows/12, 1)
+
+	for i, group := range chartGroups(columns, e.ChartSplit) {
+		var series []excelize.ChartSeries
+		var labels []string
+		for _, idx := range group {
+			series = append(series, excelize.ChartSeries{
+				Name:       sheetRef(dataSheet, idx+2, 1, 1),
+				Categories: categories,
+				Values:     sheetRef(dataSheet, idx+2, 2, lastRow),
+				Line:       excelize.ChartLine{Width: 1},
+				Marker:     excelize.ChartMarker{Symbol: "none"},
+			})
+			labels = append(labels, columns[idx].Label)
+		}
+		axisTitle := strings.Join(labels, ", ")
+
+		cell, _ := excelize.CoordinatesToCellName(1, 1+i*chartRowSpacing)
+		if err := f.AddChart(chartSheet, cell, &excelize.Chart{
+			Type:         excelize.Line,
+			Series:       series,
+			Title:        []excelize.RichTextRun{{Text: dataSheet + ": " + axisTitle}},
+			Dimension:    excelize.ChartDimension{Width: 960, Height: 400},
+			Legend:       excelize.ChartLegend{Position: "bottom"},
+			ShowBlanksAs: "gap",
+			XAxis: excelize.ChartAxis{
+				Title:         []excelize.RichTextRun{{Text: fmt.Sprintf("Waktu (%s)", e.Zona.Label)}},
+				TickLabelSkip: skip,
+				NumFmt:        excelize.ChartNumFmt{CustomNumFmt: excelDateTimeFormat},
+			},
+			YAxis: excelize.ChartAxis{
+				Title:          []excelize.RichTextRun{{Text: axisTitle}},
+				MajorGridLines: true,
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChartGroups(t *testing.T) {
+	columns := []sensorColumn{
+		{Label: "Suhu 1", Unit: "°C"},
+		{Label: "Kelembapan (%)"},
+		{Label: "Suhu 2", Unit: "°C"},
+		{Label: "Tegangan"},
+	}
+	tests := []struct {
+		split string
+		want  [][]int
+	}{
+		{"", [][]int{{0, 1, 2, 3}}},
+		{"sensor", [][]int{{0}, {1}, {2}, {3}}},
+		{"unit", [][]int{{0, 2}, {1}, {3}}},
+	}
+	for _, tt := range tests {
+		if got := chartGroups(columns, tt.split); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("chartGroups(%q) = %v, want %v", tt.split, got, tt.want)
+		}
+	}
+}
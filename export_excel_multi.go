@@ -1,10 +1,14 @@
 package main
 
 import (
+	"archive/zip"
+	"database/sql"
 	"encoding/csv"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"sort"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -33,43 +37,52 @@ func parseSensorMeta(meta string) map[string]string {
 }
 
 // ===============================
-// KONVERSI ZONA WAKTU
+// KOLOM SENSOR: LABEL DAN PRESISI
 // ===============================
-func convertTimezone(t time.Time, zonaWaktu string) time.Time {
-	// Data di database sudah dalam WIB
-	// WIB = UTC+7
-	// WITA = UTC+8 (WIB + 1 jam)
-	// WIT = UTC+9 (WIB + 2 jam)
-	
-	switch strings.ToLower(zonaWaktu) {
-	case "wita":
-		// Tambah 1 jam dari WIB
-		return t.Add(1 * time.Hour)
-	case "wit":
-		// Tambah 2 jam dari WIB
-		return t.Add(2 * time.Hour)
-	case "wib":
-		fallthrough
-	default:
-		// Tidak perlu konversi, sudah WIB
-		return t
+type sensorColumn struct {
+	Code      string
+	Label     string
+	Unit      string
+	Precision *int // nil = format default
+}
+
+// Label dari catalogue device, sensor_meta hanya menimpa label
+func sensorColumns(deviceID string, sensors []string, sensorMeta map[string]string) []sensorColumn {
+	device, err := loadDevice(deviceID)
+	if err != nil {
+		log.Println("catalogue device:", err)
 	}
+
+	columns := make([]sensorColumn, len(sensors))
+	for i, s := range sensors {
+		col := sensorColumn{Code: s, Label: strings.ToUpper(s)}
+		if p := device.parameter(s); p != nil {
+			col.Label = p.columnLabel()
+			col.Unit = p.Unit
+			col.Precision = p.Precision
+		}
+		if label, ok := sensorMeta[s]; ok {
+			col.Label = label
+		}
+		columns[i] = col
+	}
+	return columns
+}
+
+// Format nilai CSV sesuai presisi catalogue
+func (c sensorColumn) format(v float64) string {
+	if c.Precision != nil {
+		return strconv.FormatFloat(v, 'f', *c.Precision, 64)
+	}
+	return formatFloatValue(v)
 }
 
 // ===============================
-// GET ZONA WAKTU LABEL
+// LABEL ZONA WAKTU UNTUK NAMA FILE
 // ===============================
-func getZonaWaktuLabel(zonaWaktu string) string {
-	switch strings.ToLower(zonaWaktu) {
-	case "wita":
-		return "WITA"
-	case "wit":
-		return "WIT"
-	case "wib":
-		fallthrough
-	default:
-		return "WIB"
-	}
+func zonaFileLabel(zona Zona) string {
+	// Nama IANA mengandung "/" yang tidak valid untuk nama file
+	return strings.ReplaceAll(zona.Label, "/", "-")
 }
 
 // ===============================
@@ -81,61 +94,130 @@ type TimeData struct {
 }
 
 // ===============================
-// FUNGSI UNTUK AMBIL DAN PIVOT DATA
+// CURSOR PIVOT: SATU BARIS PER WAKTU, LANGSUNG DARI sql.Rows
 // ===============================
-func fetchAndPivotData(deviceID string, sensors []string, start, end time.Time, zonaWaktu string) (map[string]*TimeData, []string, error) {
-	// Query database
-	rows, err := db.Query(`
+// Lebih dari satu device: kunci Values menjadi "device:sensor" di satu sumbu waktu.
+type pivotCursor struct {
+	rows    *sql.Rows
+	raw     bool // waktu mentah perlu dikonversi ke zona; bucket sudah dikonversi di SQL
+	multi   bool
+	zona    Zona
+	row     TimeData
+	pending *pivotValue // baris yang sudah terbaca milik waktu berikutnya
+	err     error
+}
+
+type pivotValue struct {
+	time   time.Time
+	device string
+	name   string
+	value  float64
+}
+
+// Kunci kolom wide untuk satu sensor device
+func wideKey(deviceID, sensor string) string {
+	return deviceID + ":" + sensor
+}
+
+func openPivotCursor(deviceIDs, sensors []string, start, end time.Time, zona Zona, pgInterval, aggFunc string) (*pivotCursor, error) {
+	// Query database, urut waktu agar satu waktu selalu berurutan
+	query := `
 		SELECT
 			recorded_at  AS waktu,
+			device_unique_id,
 			parameter_name,
 			value
 		FROM sensor_logs
-		WHERE device_unique_id = $1
+		WHERE device_unique_id = ANY($1)
 		  AND parameter_name = ANY($2)
 		  AND recorded_at >= $3
 		  AND recorded_at <  $4
 		ORDER BY waktu ASC
-	`, deviceID, pq.Array(sensors), start, end)
+	`
+	if pgInterval != "" {
+		// Agregat per bucket (default AVG), bucket dihitung di zona waktu yang diminta
+		if aggFunc == "" {
+			aggFunc = "AVG(value)"
+		}
+		bucket, _ := bucketColumns(pgInterval, "", zona.Column)
+		query = fmt.Sprintf(`
+			SELECT
+				%s AS waktu,
+				device_unique_id,
+				parameter_name,
+				ROUND((%s)::numeric, 2)::float8 AS value
+			FROM sensor_logs
+			WHERE device_unique_id = ANY($1)
+			  AND parameter_name = ANY($2)
+			  AND recorded_at >= $3
+			  AND recorded_at <  $4
+			GROUP BY waktu, device_unique_id, parameter_name
+			ORDER BY waktu ASC
+		`, bucket, aggFunc)
+	}
+	rows, err := db.Query(query, pq.Array(deviceIDs), pq.Array(sensors), start.In(lokasiWIB), end.In(lokasiWIB))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	defer rows.Close()
-
-	// Pivot data
-	dataMap := map[string]*TimeData{}
-	var timeKeys []string
+	return &pivotCursor{rows: rows, raw: pgInterval == "", multi: len(deviceIDs) > 1, zona: zona}, nil
+}
 
-	for rows.Next() {
-		var t time.Time
-		var name string
-		var val float64
-		if err := rows.Scan(&t, &name, &val); err != nil {
+// Baca baris database berikutnya ke pending; false jika data habis
+func (c *pivotCursor) fill() bool {
+	for c.pending == nil {
+		if !c.rows.Next() {
+			return false
+		}
+		var v pivotValue
+		if err := c.rows.Scan(&v.time, &v.device, &v.name, &v.value); err != nil {
 			continue
 		}
+		if c.raw {
+			v.time = c.zona.FromDatabase(v.time)
+		}
+		if c.multi {
+			v.name = wideKey(v.device, v.name)
+		}
+		c.pending = &v
+	}
+	return true
+}
 
-		// Konversi waktu sesuai zona waktu yang diminta
-		convertedTime := convertTimezone(t, zonaWaktu)
-		key := convertedTime.Format("2006-01-02 15:04:05")
-
-		if _, ok := dataMap[key]; !ok {
-			dataMap[key] = &TimeData{
-				Time:   convertedTime,
-				Values: map[string]float64{},
-			}
-			timeKeys = append(timeKeys, key)
+// Maju ke baris pivot berikutnya; nilai sensor dikumpulkan sampai waktunya berganti
+func (c *pivotCursor) Next() bool {
+	var cur *TimeData
+	for c.fill() {
+		if cur == nil {
+			cur = &TimeData{Time: c.pending.time, Values: map[string]float64{}}
+		} else if !c.pending.time.Equal(cur.Time) {
+			break
 		}
-		dataMap[key].Values[name] = val
+		cur.Values[c.pending.name] = c.pending.value
+		c.pending = nil
 	}
+	if cur == nil {
+		c.err = c.rows.Err()
+		return false
+	}
+	c.row = *cur
+	return true
+}
 
-	// Sort berdasarkan waktu
-	sort.Slice(timeKeys, func(i, j int) bool {
-		return dataMap[timeKeys[i]].Time.Before(dataMap[timeKeys[j]].Time)
-	})
+func (c *pivotCursor) Row() TimeData { return c.row }
 
-	return dataMap, timeKeys, nil
+// Masih ada baris pivot setelah baris sekarang, tanpa memajukan cursor
+func (c *pivotCursor) More() bool {
+	if c.fill() {
+		return true
+	}
+	c.err = c.rows.Err()
+	return false
 }
 
+func (c *pivotCursor) Err() error { return c.err }
+
+func (c *pivotCursor) Close() error { return c.rows.Close() }
+
 // ===============================
 // FORMAT FLOAT UNTUK CSV/EXCEL
 // ===============================
@@ -154,150 +236,523 @@ func formatFloatValue(v float64) string {
 }
 
 // ===============================
-// EXPORT CSV MULTI SENSOR (DIPERBAIKI)
+// PARAMETER EXPORT
 // ===============================
-func exportCSVMultiSensor(w http.ResponseWriter, deviceID, bulan, tahun string, sensors []string, sensorMeta map[string]string, zonaWaktu string) {
-	// Range waktu bulan
-	start, err := time.Parse("2006-01-02", fmt.Sprintf("%s-%s-01", tahun, bulan))
-	if err != nil {
-		http.Error(w, "format bulan/tahun salah", http.StatusBadRequest)
-		return
+const maxExportRange = 366 * 24 * time.Hour
+
+// Device yang di-export beserta kolom sensornya (label dari catalogue device itu)
+type exportDevice struct {
+	ID      string
+	Columns []sensorColumn
+}
+
+// Parameter export yang sudah divalidasi
+type exportRequest struct {
+	Devices    []exportDevice
+	Sensors    []string
+	Zona       Zona
+	PgInterval string
+	AggFunc    string
+	Start, End time.Time
+	Label      string // bagian nama file, mis. "01_2026" atau "20260101_20260401"
+	Split      string // "" | "sheet" (satu sheet per bulan) | "zip" (satu file per bulan)
+	Wide       bool   // multi device: sheet/CSV gabungan dengan kolom device:sensor
+	Long       bool   // CSV: satu baris per nilai dengan kolom device
+	Chart      string // "" | "line": sheet grafik untuk tiap sheet data
+	ChartSplit string // "" (satu grafik) | "sensor" (satu grafik per sensor) | "unit" (satu grafik per satuan)
+}
+
+func (e exportRequest) multiDevice() bool {
+	return len(e.Devices) > 1
+}
+
+func (e exportRequest) deviceIDs() []string {
+	ids := make([]string, len(e.Devices))
+	for i, d := range e.Devices {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+// Kunci nilai di TimeData: kode sensor, atau device:sensor untuk cursor multi device
+func (e exportRequest) valueKey(deviceID, sensor string) string {
+	if e.multiDevice() {
+		return wideKey(deviceID, sensor)
+	}
+	return sensor
+}
+
+// Kolom untuk cursor semua device: satu device apa adanya, multi device device:sensor
+func (e exportRequest) wideColumns() []sensorColumn {
+	if !e.multiDevice() {
+		return e.Devices[0].Columns
+	}
+	var columns []sensorColumn
+	for _, d := range e.Devices {
+		for _, c := range d.Columns {
+			c.Code = wideKey(d.ID, c.Code)
+			c.Label = wideKey(d.ID, c.Label)
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+// Satu bagian export: seluruh range, atau satu bulan jika di-split
+type exportPart struct {
+	Name       string
+	Start, End time.Time
+}
+
+// Pecah range per bulan kalender di zona waktu export
+func (e exportRequest) monthParts() []exportPart {
+	var parts []exportPart
+	for s := e.Start; s.Before(e.End); {
+		next := time.Date(s.Year(), s.Month()+1, 1, 0, 0, 0, 0, e.Zona.Loc)
+		if next.After(e.End) {
+			next = e.End
+		}
+		parts = append(parts, exportPart{Name: s.Format("2006-01"), Start: s, End: next})
+		s = next
 	}
-	end := start.AddDate(0, 1, 0)
+	return parts
+}
+
+func (e exportRequest) filename(label, ext string) string {
+	return fmt.Sprintf("Report_AllSensors_%s_%s.%s", label, zonaFileLabel(e.Zona), ext)
+}
 
-	// Fetch dan pivot data
-	dataMap, timeKeys, err := fetchAndPivotData(deviceID, sensors, start, end, zonaWaktu)
+// Awal bulan dari bulan (MM atau MM-YYYY) dan tahun
+func parseExportMonth(bulan, tahun string, loc *time.Location) (time.Time, error) {
+	month, year := parseMonth(bulan)
+	if tahun != "" && !strings.Contains(bulan, "-") {
+		year = tahun
+	}
+	start, err := time.ParseInLocation("2006-01-02", fmt.Sprintf("%s-%s-01", year, month), loc)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return time.Time{}, fmt.Errorf("format bulan/tahun salah")
+	}
+	return start, nil
+}
+
+// Range export: from/to, bulan_awal/bulan_akhir, atau satu bulan (bulan/tahun)
+func resolveExportRange(q url.Values, loc *time.Location) (start, end time.Time, label string, err error) {
+	switch {
+	case q.Get("from") != "":
+		start, end, err = resolveTimeRange(q.Get("from"), q.Get("to"), loc, maxExportRange)
+		if err != nil {
+			return
+		}
+		label = start.Format("20060102") + "_" + end.Format("20060102")
+		return
+
+	case q.Get("bulan_awal") != "":
+		bulanAkhir := q.Get("bulan_akhir")
+		if bulanAkhir == "" {
+			bulanAkhir = q.Get("bulan_awal")
+		}
+		if start, err = parseExportMonth(q.Get("bulan_awal"), q.Get("tahun"), loc); err != nil {
+			return
+		}
+		var last time.Time
+		if last, err = parseExportMonth(bulanAkhir, q.Get("tahun"), loc); err != nil {
+			return
+		}
+		end = last.AddDate(0, 1, 0)
+		if !start.Before(end) {
+			err = fmt.Errorf("bulan_awal harus sebelum atau sama dengan bulan_akhir")
+			return
+		}
+		if end.Sub(start) > maxExportRange {
+			err = fmt.Errorf("rentang export maksimal 12 bulan")
+			return
+		}
+		label = start.Format("2006-01") + "_" + last.Format("2006-01")
+		return
+
+	default:
+		bulan, tahun := q.Get("bulan"), q.Get("tahun")
+		if bulan == "" || tahun == "" {
+			err = fmt.Errorf("bulan dan tahun (atau from/to, bulan_awal/bulan_akhir) wajib diisi")
+			return
+		}
+		if start, err = parseExportMonth(bulan, tahun, loc); err != nil {
+			return
+		}
+		end = start.AddDate(0, 1, 0)
+		label = fmt.Sprintf("%s_%s", bulan, tahun)
 		return
 	}
+}
 
-	// Set header untuk download CSV
-	zonaLabel := getZonaWaktuLabel(zonaWaktu)
-	filename := fmt.Sprintf("Report_AllSensors_%s_%s_%s.csv", bulan, tahun, zonaLabel)
-	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
-	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+// ===============================
+// TULIS CSV SATU BAGIAN
+// ===============================
 
+// Wide: satu baris per waktu, satu kolom per sensor
+func writeCSVPart(out io.Writer, e exportRequest, columns []sensorColumn, cursor *pivotCursor) error {
 	// Tulis BOM UTF-8 agar Excel bisa baca encoding dengan benar
-	w.Write([]byte{0xEF, 0xBB, 0xBF})
+	out.Write([]byte{0xEF, 0xBB, 0xBF})
 
 	// Buat CSV writer
-	writer := csv.NewWriter(w)
+	writer := csv.NewWriter(out)
 	defer writer.Flush()
 
 	// Header
 	headers := []string{"No"}
-	for _, s := range sensors {
-		if label, ok := sensorMeta[s]; ok {
-			headers = append(headers, label)
-		} else {
-			headers = append(headers, strings.ToUpper(s))
-		}
+	for _, c := range columns {
+		headers = append(headers, c.Label)
 	}
-	headers = append(headers, fmt.Sprintf("Waktu (%s)", zonaLabel))
+	headers = append(headers, fmt.Sprintf("Waktu (%s)", e.Zona.Label))
 	writer.Write(headers)
 
-	// Data rows
-	for no, timeKey := range timeKeys {
-		values := dataMap[timeKey].Values
-
-		row := []string{fmt.Sprintf("%d", no+1)}
-		for _, s := range sensors {
-			if v, ok := values[s]; ok {
-				// Gunakan formatFloatValue untuk menghilangkan trailing zeros
-				row = append(row, formatFloatValue(v))
+	// Data rows, langsung dari cursor
+	for no := 1; cursor.Next(); no++ {
+		data := cursor.Row()
+
+		row := []string{fmt.Sprintf("%d", no)}
+		for _, c := range columns {
+			if v, ok := data.Values[c.Code]; ok {
+				// Presisi catalogue, atau tanpa trailing zeros
+				row = append(row, c.format(v))
+			} else if e.multiDevice() {
+				row = append(row, "") // waktu antar device tidak selalu sama
 			} else {
 				row = append(row, "0") // atau "" jika ingin kosong
 			}
 		}
-		row = append(row, timeKey)
+		row = append(row, data.Time.Format("2006-01-02 15:04:05"))
 
 		writer.Write(row)
 	}
+	return cursor.Err()
 }
 
-// ===============================
-// EXPORT EXCEL MULTI SENSOR (DIPERBAIKI)
-// ===============================
-func exportExcelMultiSensorData(w http.ResponseWriter, deviceID, bulan, tahun string, sensors []string, sensorMeta map[string]string, zonaWaktu string) {
-	// Range waktu bulan
-	start, err := time.Parse("2006-01-02", fmt.Sprintf("%s-%s-01", tahun, bulan))
-	if err != nil {
-		http.Error(w, "format bulan/tahun salah", http.StatusBadRequest)
-		return
+// Long: satu baris per nilai, dengan kolom device dan sensor
+func writeCSVLong(out io.Writer, e exportRequest, cursor *pivotCursor) error {
+	out.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(out)
+	defer writer.Flush()
+
+	writer.Write([]string{"No", "Device", "Sensor", "Nilai", fmt.Sprintf("Waktu (%s)", e.Zona.Label)})
+
+	no := 1
+	for cursor.Next() {
+		data := cursor.Row()
+		waktu := data.Time.Format("2006-01-02 15:04:05")
+		for _, d := range e.Devices {
+			for _, c := range d.Columns {
+				v, ok := data.Values[e.valueKey(d.ID, c.Code)]
+				if !ok {
+					continue
+				}
+				writer.Write([]string{strconv.Itoa(no), d.ID, c.Label, c.format(v), waktu})
+				no++
+			}
+		}
 	}
-	end := start.AddDate(0, 1, 0)
+	return cursor.Err()
+}
 
-	// Fetch dan pivot data
-	dataMap, timeKeys, err := fetchAndPivotData(deviceID, sensors, start, end, zonaWaktu)
+// CSV satu bagian sesuai layout (long, wide gabungan, atau satu device)
+func writeCSV(out io.Writer, e exportRequest, part exportPart) error {
+	cursor, err := openPivotCursor(e.deviceIDs(), e.Sensors, part.Start, part.End, e.Zona, e.PgInterval, e.AggFunc)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
+	defer cursor.Close()
 
-	// Buat Excel
-	f := excelize.NewFile()
-	sheet := "Data Sensor"
-	f.SetSheetName("Sheet1", sheet)
+	if e.Long {
+		return writeCSVLong(out, e, cursor)
+	}
+	return writeCSVPart(out, e, e.wideColumns(), cursor)
+}
 
-	// Header
-	headers := []interface{}{"No"}
-	for _, s := range sensors {
-		if label, ok := sensorMeta[s]; ok {
-			headers = append(headers, label)
-		} else {
-			headers = append(headers, strings.ToUpper(s))
-		}
+// ===============================
+// TULIS SHEET EXCEL SATU BAGIAN (STREAMWRITER)
+// ===============================
+// Hasil: jumlah baris data (tanpa header)
+func writeExcelSheet(f *excelize.File, sheet string, e exportRequest, columns []sensorColumn, cursor *pivotCursor, blankMissing bool) (int, error) {
+	// StreamWriter: baris ditulis berurutan ke file sementara, bukan ke worksheet di memori
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return 0, err
 	}
-	zonaLabel := getZonaWaktuLabel(zonaWaktu)
-	headers = append(headers, fmt.Sprintf("Waktu (%s)", zonaLabel))
-	f.SetSheetRow(sheet, "A1", &headers)
 
-	// Atur style untuk angka (opsional, agar tampilan lebih rapi)
-	style, _ := f.NewStyle(&excelize.Style{
+	// Style angka per kolom: presisi catalogue, default 2 desimal.
+	// Style dan lebar kolom dipasang sekali per kolom sebelum baris pertama.
+	defaultStyle, _ := f.NewStyle(&excelize.Style{
 		NumFmt: 2, // Format angka dengan 2 desimal
 	})
+	for i, c := range columns {
+		style := defaultStyle
+		if c.Precision != nil {
+			numFmt := "0"
+			if *c.Precision > 0 {
+				numFmt += "." + strings.Repeat("0", *c.Precision)
+			}
+			style, _ = f.NewStyle(&excelize.Style{CustomNumFmt: &numFmt})
+		}
+		// Kolom B sampai kolom sebelum waktu
+		sw.SetColStyle(i+2, i+2, style)
+	}
+	// Kolom waktu berisi tanggal Excel, bukan teks
+	timeStyle := excelDateTimeStyle(f)
+	sw.SetColStyle(len(columns)+2, len(columns)+2, timeStyle)
+	sw.SetColWidth(1, len(columns)+1, 15)
+	sw.SetColWidth(len(columns)+2, len(columns)+2, 20)
+
+	// Header
+	headers := []interface{}{"No"}
+	for _, c := range columns {
+		headers = append(headers, c.Label)
+	}
+	headers = append(headers, fmt.Sprintf("Waktu (%s)", e.Zona.Label))
+	sw.SetRow("A1", headers)
 
-	// Data rows
+	// Data rows, langsung dari cursor; berhenti di batas baris Excel, sisanya untuk sheet berikutnya
 	rowNum := 2
-	for no, timeKey := range timeKeys {
-		values := dataMap[timeKey].Values
+	for rowNum <= excelMaxRows && cursor.Next() {
+		data := cursor.Row()
 
-		rowData := []interface{}{no + 1}
-		for _, s := range sensors {
-			if v, ok := values[s]; ok {
+		rowData := []interface{}{rowNum - 1}
+		for _, c := range columns {
+			if v, ok := data.Values[c.Code]; ok {
 				rowData = append(rowData, v)
+			} else if blankMissing {
+				rowData = append(rowData, nil)
 			} else {
 				rowData = append(rowData, 0) // atau nil jika ingin kosong
 			}
 		}
-		rowData = append(rowData, timeKey)
+		rowData = append(rowData, excelize.Cell{StyleID: timeStyle, Value: data.Time})
 
 		cell, _ := excelize.CoordinatesToCellName(1, rowNum)
-		f.SetSheetRow(sheet, cell, &rowData)
-		
-		// Terapkan style untuk kolom angka (kolom B sampai kolom sebelum waktu)
-		for col := 2; col <= len(sensors)+1; col++ {
-			cellName, _ := excelize.CoordinatesToCellName(col, rowNum)
-			f.SetCellStyle(sheet, cellName, cellName, style)
-		}
-		
+		if err := sw.SetRow(cell, rowData); err != nil {
+			return 0, err
+		}
 		rowNum++
 	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+	return rowNum - 2, sw.Flush()
+}
+
+// Batas baris satu worksheet Excel (termasuk header)
+const excelMaxRows = 1048576
+
+// Format sel waktu di Excel
+const excelDateTimeFormat = "yyyy-mm-dd hh:mm:ss"
+
+// Style sel tanggal-waktu; nilai time.Time ditulis sebagai jam dinding di zonanya
+func excelDateTimeStyle(f *excelize.File) int {
+	numFmt := excelDateTimeFormat
+	style, _ := f.NewStyle(&excelize.Style{CustomNumFmt: &numFmt})
+	return style
+}
+
+// Nama sheet Excel: tanpa karakter terlarang, maksimal 31 karakter, unik
+func excelSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+	base := name
+	for i := 2; used[name]; i++ {
+		suffix := fmt.Sprintf("~%d", i)
+		r := []rune(base)
+		if len(r)+len(suffix) > 31 {
+			r = r[:31-len(suffix)]
+		}
+		name = string(r) + suffix
+	}
+	used[name] = true
+	return name
+}
+
+// Workbook dengan sheet per bagian waktu: satu sheet per device,
+// ditambah sheet gabungan (wide) jika diminta, lalu sheet Ringkasan seluruh range
+func buildWorkbook(e exportRequest, parts []exportPart) (*excelize.File, error) {
+	f := excelize.NewFile()
+	used := map[string]bool{}
+	first := true
+
+	// Data melebihi batas baris Excel dilanjutkan ke sheet "<nama> (2)", "<nama> (3)", dst.
+	addSheet := func(name string, part exportPart, deviceIDs []string, columns []sensorColumn, blankMissing bool) error {
+		cursor, err := openPivotCursor(deviceIDs, e.Sensors, part.Start, part.End, e.Zona, e.PgInterval, e.AggFunc)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close()
+
+		for n := 1; n == 1 || cursor.More(); n++ {
+			sheet := name
+			if n > 1 {
+				sheet = fmt.Sprintf("%s (%d)", name, n)
+			}
+			sheet = excelSheetName(sheet, used)
+			if first {
+				f.SetSheetName("Sheet1", sheet)
+				first = false
+			} else if _, err := f.NewSheet(sheet); err != nil {
+				return err
+			}
+			rows, err := writeExcelSheet(f, sheet, e, columns, cursor, blankMissing)
+			if err != nil {
+				return err
+			}
+			if e.Chart != "" && rows > 0 {
+				if err := addLineCharts(f, sheet, excelSheetName("Grafik "+sheet, used), e, columns, rows); err != nil {
+					return err
+				}
+			}
+		}
+		return cursor.Err()
+	}
 
-	// Auto fit column width
-	for col := 1; col <= len(sensors)+2; col++ {
-		colName, _ := excelize.ColumnNumberToName(col)
-		f.SetColWidth(sheet, colName, colName, 15)
+	for _, part := range parts {
+		for _, d := range e.Devices {
+			name := part.Name
+			if e.multiDevice() {
+				name = strings.TrimSpace(d.ID + " " + part.Name)
+			}
+			if name == "" {
+				name = "Data Sensor"
+			}
+			if err := addSheet(name, part, []string{d.ID}, d.Columns, false); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+		if e.Wide && e.multiDevice() {
+			// Sumbu waktu bersama: sel kosong jika device tidak punya data di waktu itu
+			name := strings.TrimSpace("Gabungan " + part.Name)
+			if err := addSheet(name, part, e.deviceIDs(), e.wideColumns(), true); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+
+	summary := excelSheetName("Ringkasan", used)
+	if _, err := f.NewSheet(summary); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := writeSummarySheet(f, summary, e, parts[0].Start, parts[len(parts)-1].End); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// ===============================
+// EXPORT CSV MULTI SENSOR
+// ===============================
+func exportCSVMultiSensor(w http.ResponseWriter, e exportRequest) {
+	// Buka cursor data pivot
+	cursor, err := openPivotCursor(e.deviceIDs(), e.Sensors, e.Start, e.End, e.Zona, e.PgInterval, e.AggFunc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close()
+
+	// Set header untuk download CSV
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+e.filename(e.Label, "csv")+`"`)
+
+	if e.Long {
+		err = writeCSVLong(w, e, cursor)
+	} else {
+		err = writeCSVPart(w, e, e.wideColumns(), cursor)
+	}
+	// Header 200 sudah terkirim: putus koneksi agar CSV terpotong tidak terlihat lengkap
+	if err != nil {
+		log.Println("export csv:", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// ===============================
+// EXPORT EXCEL MULTI SENSOR
+// ===============================
+func exportExcelMultiSensorData(w http.ResponseWriter, e exportRequest) {
+	parts := []exportPart{{Start: e.Start, End: e.End}}
+	if e.Split == "sheet" {
+		parts = e.monthParts()
+	}
+
+	f, err := buildWorkbook(e, parts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	defer f.Close()
 
 	// Response download
-	zonaLabel = getZonaWaktuLabel(zonaWaktu)
-	filename := fmt.Sprintf("Report_AllSensors_%s_%s_%s.xlsx", bulan, tahun, zonaLabel)
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+e.filename(e.Label, "xlsx")+`"`)
+	// Body sudah berjalan: jangan tulis pesan error ke dalam xlsx, putus koneksi saja
 	if err := f.Write(w); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Println("export excel:", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// ===============================
+// EXPORT ZIP: SATU FILE PER BULAN
+// ===============================
+func exportZipMultiSensor(w http.ResponseWriter, e exportRequest, outputFormat string) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+e.filename(e.Label, "zip")+`"`)
+
+	zw := zip.NewWriter(w)
+
+	// Response sudah berjalan: jika gagal di tengah, putus koneksi tanpa menulis
+	// central directory agar client tidak menerima ZIP valid yang isinya terpotong
+	abort := func(err error) {
+		log.Println("export zip:", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	for _, part := range e.monthParts() {
+		label := part.Name
+		part.Name = ""
+
+		if outputFormat == "csv" {
+			entry, err := zw.Create(e.filename(label, "csv"))
+			if err == nil {
+				err = writeCSV(entry, e, part)
+			}
+			if err != nil {
+				abort(err)
+			}
+			continue
+		}
+
+		f, err := buildWorkbook(e, []exportPart{part})
+		if err != nil {
+			abort(err)
+		}
+		entry, err := zw.Create(e.filename(label, "xlsx"))
+		if err == nil {
+			err = f.Write(entry)
+		}
+		f.Close()
+		if err != nil {
+			abort(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		abort(err)
 	}
 }
 
@@ -307,27 +762,27 @@ func exportExcelMultiSensorData(w http.ResponseWriter, deviceID, bulan, tahun st
 func exportExcelMultiSensor(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	deviceID := q.Get("device_id")
-	bulan := q.Get("bulan")
-	tahun := q.Get("tahun")
 	sensorParam := q.Get("sensors")
 	sensorMetaParam := q.Get("sensor_meta")
 	zonaWaktu := q.Get("zonawaktu")
 	outputFormat := q.Get("out")
-
-	// Default zona waktu adalah WIB jika tidak diisi
-	if zonaWaktu == "" {
-		zonaWaktu = "wib"
-	}
+	interval := q.Get("interval")
+	valueMode := q.Get("value")
+	split := q.Get("split")
+	layout := q.Get("layout")
+	wide := q.Get("wide") == "1" || q.Get("wide") == "true"
+	chart := q.Get("chart")
+	chartSplit := q.Get("chart_split")
 
 	// Default output format adalah excel jika tidak diisi
 	if outputFormat == "" {
 		outputFormat = "excel"
 	}
 
-	// Validasi zona waktu
-	zonaWaktuLower := strings.ToLower(zonaWaktu)
-	if zonaWaktuLower != "wib" && zonaWaktuLower != "wita" && zonaWaktuLower != "wit" {
-		http.Error(w, "zonawaktu harus wib, wita, atau wit", http.StatusBadRequest)
+	// Validasi zona waktu (default WIB jika tidak diisi)
+	zona, err := resolveZona(zonaWaktu)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -338,19 +793,114 @@ func exportExcelMultiSensor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validasi split per bulan (opsional)
+	switch split {
+	case "", "zip":
+	case "sheet":
+		if outputFormatLower != "excel" {
+			http.Error(w, "split=sheet hanya untuk out=excel", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "split harus sheet atau zip", http.StatusBadRequest)
+		return
+	}
+
+	// Validasi layout CSV (opsional)
+	if layout != "" && (layout != "long" || outputFormatLower != "csv") {
+		http.Error(w, "layout hanya long, untuk out=csv", http.StatusBadRequest)
+		return
+	}
+
+	// Validasi grafik (opsional, hanya excel)
+	if chart != "" && (chart != "line" || outputFormatLower != "excel") {
+		http.Error(w, "chart hanya line, untuk out=excel", http.StatusBadRequest)
+		return
+	}
+	if chartSplit != "" && (chart == "" || (chartSplit != "sensor" && chartSplit != "unit")) {
+		http.Error(w, "chart_split harus sensor atau unit, bersama chart=line", http.StatusBadRequest)
+		return
+	}
+
 	// Validasi parameter wajib
-	if deviceID == "" || bulan == "" || tahun == "" || sensorParam == "" {
-		http.Error(w, "device_id, bulan, tahun, sensors wajib diisi", http.StatusBadRequest)
+	if deviceID == "" || sensorParam == "" {
+		http.Error(w, "device_id, sensors wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	// Range waktu export
+	start, end, label, err := resolveExportRange(q, zona.Loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validasi interval (opsional, kosong = data mentah)
+	pgInterval, err := parseBucketInterval(interval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validasi value agregat per bucket (avg | high | low | median | pNN)
+	aggFunc := ""
+	if valueMode != "" {
+		if pgInterval == "" {
+			http.Error(w, "value hanya bisa dipakai bersama interval", http.StatusBadRequest)
+			return
+		}
+		var ok bool
+		if aggFunc, ok = valueAggFunc(valueMode); !ok {
+			http.Error(w, "value hanya high | low | avg | median | pNN", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Semua device (device_id=a,b,c) harus bisa diakses token; export tidak boleh diam-diam kurang device
+	deviceIDs := splitList(deviceID)
+	identity := identityFromContext(r.Context())
+	var denied []string
+	for _, id := range deviceIDs {
+		if !identity.CanAccessDevice(id) {
+			denied = append(denied, id)
+		}
+	}
+	if len(denied) > 0 {
+		respondError(w, "Token tidak punya akses ke device: "+strings.Join(denied, ","), http.StatusForbidden)
 		return
 	}
 
 	sensors := strings.Split(sensorParam, ",")
 	sensorMeta := parseSensorMeta(sensorMetaParam)
+	devices := make([]exportDevice, len(deviceIDs))
+	for i, id := range deviceIDs {
+		devices[i] = exportDevice{ID: id, Columns: sensorColumns(id, sensors, sensorMeta)}
+	}
+
+	e := exportRequest{
+		Devices:    devices,
+		Sensors:    sensors,
+		Zona:       zona,
+		PgInterval: pgInterval,
+		AggFunc:    aggFunc,
+		Start:      start,
+		End:        end,
+		Label:      label,
+		Split:      split,
+		Wide:       wide,
+		Chart:      chart,
+		ChartSplit: chartSplit,
+	}
+	// CSV multi device default long, kecuali diminta wide
+	e.Long = outputFormatLower == "csv" && (layout == "long" || (e.multiDevice() && !wide))
 
 	// Route ke fungsi export yang sesuai
-	if outputFormatLower == "csv" {
-		exportCSVMultiSensor(w, deviceID, bulan, tahun, sensors, sensorMeta, zonaWaktu)
-	} else {
-		exportExcelMultiSensorData(w, deviceID, bulan, tahun, sensors, sensorMeta, zonaWaktu)
+	switch {
+	case split == "zip":
+		exportZipMultiSensor(w, e, outputFormatLower)
+	case outputFormatLower == "csv":
+		exportCSVMultiSensor(w, e)
+	default:
+		exportExcelMultiSensorData(w, e)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestExcelSheetName(t *testing.T) {
+	used := map[string]bool{}
+	long := strings.Repeat("a", 40)
+	tests := []struct {
+		in, want string
+	}{
+		{"Data Sensor", "Data Sensor"},
+		{"Data Sensor", "Data Sensor~2"},
+		{"Data Sensor", "Data Sensor~3"},
+		{"dev/01 [a]:b*c?d\\e", "dev_01 _a__b_c_d_e"},
+		{long, strings.Repeat("a", 31)},
+		{long, strings.Repeat("a", 29) + "~2"},
+		{"Januari 2026 (2)", "Januari 2026 (2)"},
+		{"Sensör çok uzun bir başlık ile 2026", "Sensör çok uzun bir başlık ile "},
+	}
+	for _, tt := range tests {
+		got := excelSheetName(tt.in, used)
+		if got != tt.want {
+			t.Errorf("excelSheetName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > 31 {
+			t.Errorf("excelSheetName(%q) panjang %d > 31", tt.in, n)
+		}
+	}
+}
+
+func TestMonthParts(t *testing.T) {
+	zona, _ := resolveZona("wita")
+	loc := zona.Loc
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []string
+	}{
+		{"satu bulan penuh",
+			time.Date(2026, 1, 1, 0, 0, 0, 0, loc), time.Date(2026, 2, 1, 0, 0, 0, 0, loc),
+			[]string{"2026-01 01-01/02-01"}},
+		{"lintas tahun, awal dan akhir di tengah bulan",
+			time.Date(2025, 11, 15, 0, 0, 0, 0, loc), time.Date(2026, 1, 10, 12, 0, 0, 0, loc),
+			[]string{"2025-11 11-15/12-01", "2025-12 12-01/01-01", "2026-01 01-01/01-10"}},
+		{"range kosong", time.Date(2026, 1, 1, 0, 0, 0, 0, loc), time.Date(2026, 1, 1, 0, 0, 0, 0, loc), nil},
+	}
+	for _, tt := range tests {
+		e := exportRequest{Zona: zona, Start: tt.start, End: tt.end}
+		var got []string
+		for _, p := range e.monthParts() {
+			got = append(got, p.Name+" "+p.Start.Format("01-02")+"/"+p.End.Format("01-02"))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: monthParts = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveExportRange(t *testing.T) {
+	loc := time.FixedZone("WIB", 7*3600)
+	tests := []struct {
+		query     string
+		wantStart string
+		wantEnd   string
+		wantLabel string
+		wantErr   bool
+	}{
+		{"bulan=03&tahun=2026", "2026-03-01", "2026-04-01", "03_2026", false},
+		{"bulan_awal=11-2025&bulan_akhir=02-2026", "2025-11-01", "2026-03-01", "2025-11_2026-02", false},
+		{"bulan_awal=05&tahun=2026", "2026-05-01", "2026-06-01", "2026-05_2026-05", false},
+		{"from=2026-01-01&to=2026-01-15", "2026-01-01", "2026-01-15", "20260101_20260115", false},
+		{"bulan_awal=03-2026&bulan_akhir=01-2026", "", "", "", true},
+		{"bulan_awal=01-2025&bulan_akhir=02-2026", "", "", "", true},
+		{"from=2025-01-01&to=2026-06-01", "", "", "", true},
+		{"bulan=03", "", "", "", true},
+		{"bulan=xx&tahun=2026", "", "", "", true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		start, end, label, err := resolveExportRange(q, loc)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if start.Format("2006-01-02") != tt.wantStart || end.Format("2006-01-02") != tt.wantEnd || label != tt.wantLabel {
+			t.Errorf("%s = %s %s %s, want %s %s %s", tt.query,
+				start.Format("2006-01-02"), end.Format("2006-01-02"), label, tt.wantStart, tt.wantEnd, tt.wantLabel)
+		}
+	}
+}
+
+func TestExportDeniedDevice(t *testing.T) {
+	identity := &Identity{Name: "test", DevicePatterns: []string{"dev-a*"}}
+	req := httptest.NewRequest(http.MethodGet, "/api/export?device_id=dev-a1,dev-b1,dev-c1&sensors=suhu&from=2026-01-01&to=2026-01-02", nil)
+	req = req.WithContext(withIdentity(req.Context(), identity))
+	rec := httptest.NewRecorder()
+	exportExcelMultiSensor(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var resp Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("body bukan JSON: %v", err)
+	}
+	if resp.Status || resp.Message != "Token tidak punya akses ke device: dev-b1,dev-c1" {
+		t.Errorf("response = %+v", resp)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/xuri/excelize/v2"
+)
+
+// ===============================
+// RINGKASAN STATISTIK PER SENSOR
+// ===============================
+type sensorSummary struct {
+	Min, Max, Avg float64
+	StdDev        sql.NullFloat64 // kosong jika hanya satu sampel
+	Count         int64
+	MinAt, MaxAt  time.Time
+	FilledSlots   int64 // slot interval lapor yang berisi data
+}
+
+// Statistik data mentah tiap device:sensor dalam range (tidak terpengaruh interval/value export).
+// Slot terisi dihitung terhadap interval lapor device dari konfigurasi device_health.
+func fetchSummaries(e exportRequest, start, end time.Time) (map[string]sensorSummary, error) {
+	deviceIDs := e.deviceIDs()
+	seconds := make([]float64, len(deviceIDs))
+	for i, id := range deviceIDs {
+		seconds[i] = config.DeviceHealth.intervalFor(id).Seconds()
+	}
+
+	rows, err := db.Query(`
+		WITH iv AS (
+			SELECT * FROM unnest($1::text[], $5::float8[]) AS iv(device_unique_id, seconds)
+		),
+		s AS (
+			SELECT l.device_unique_id, l.parameter_name, l.value, l.recorded_at, iv.seconds
+			FROM sensor_logs l
+			JOIN iv ON iv.device_unique_id = l.device_unique_id
+			WHERE l.parameter_name = ANY($2)
+			  AND l.recorded_at >= $3::timestamp
+			  AND l.recorded_at <  $4::timestamp
+		),
+		agg AS (
+			SELECT device_unique_id, parameter_name,
+			       MIN(value) AS min_value, MAX(value) AS max_value, AVG(value) AS avg_value,
+			       STDDEV_SAMP(value) AS stddev_value, COUNT(*) AS sample_count,
+			       COUNT(DISTINCT FLOOR(EXTRACT(EPOCH FROM recorded_at - $3::timestamp) / seconds)) AS filled_slots
+			FROM s
+			GROUP BY device_unique_id, parameter_name
+		),
+		lo AS (
+			SELECT DISTINCT ON (device_unique_id, parameter_name) device_unique_id, parameter_name, recorded_at
+			FROM s
+			ORDER BY device_unique_id, parameter_name, value ASC, recorded_at
+		),
+		hi AS (
+			SELECT DISTINCT ON (device_unique_id, parameter_name) device_unique_id, parameter_name, recorded_at
+			FROM s
+			ORDER BY device_unique_id, parameter_name, value DESC, recorded_at
+		)
+		SELECT a.device_unique_id, a.parameter_name,
+		       a.min_value, lo.recorded_at, a.max_value, hi.recorded_at,
+		       a.avg_value, a.stddev_value, a.sample_count, a.filled_slots
+		FROM agg a
+		JOIN lo ON lo.device_unique_id = a.device_unique_id AND lo.parameter_name = a.parameter_name
+		JOIN hi ON hi.device_unique_id = a.device_unique_id AND hi.parameter_name = a.parameter_name
+	`, pq.Array(deviceIDs), pq.Array(e.Sensors), start.In(lokasiWIB), end.In(lokasiWIB), pq.Array(seconds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := map[string]sensorSummary{}
+	for rows.Next() {
+		var device, sensor string
+		var s sensorSummary
+		if err := rows.Scan(&device, &sensor, &s.Min, &s.MinAt, &s.Max, &s.MaxAt,
+			&s.Avg, &s.StdDev, &s.Count, &s.FilledSlots); err != nil {
+			return nil, err
+		}
+		summaries[wideKey(device, sensor)] = s
+	}
+	return summaries, rows.Err()
+}
+
+// Jumlah slot interval lapor dalam range, hanya sampai sekarang
+func expectedSlots(start, end time.Time, interval time.Duration) int64 {
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	if !end.After(start) || interval <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(end.Sub(start)) / float64(interval)))
+}
+
+// ===============================
+// SHEET RINGKASAN
+// ===============================
+func writeSummarySheet(f *excelize.File, sheet string, e exportRequest, start, end time.Time) error {
+	summaries, err := fetchSummaries(e, start, end)
+	if err != nil {
+		return err
+	}
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	// Style: nilai sesuai presisi sensor (default 2 desimal), jumlah tanpa desimal
+	defaultStyle, _ := f.NewStyle(&excelize.Style{NumFmt: 2})
+	countStyle, _ := f.NewStyle(&excelize.Style{NumFmt: 3}) // #,##0
+	headerStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	timeStyle := excelDateTimeStyle(f)
+	valueStyles := map[int]int{}
+	valueStyle := func(c sensorColumn) int {
+		if c.Precision == nil {
+			return defaultStyle
+		}
+		if style, ok := valueStyles[*c.Precision]; ok {
+			return style
+		}
+		numFmt := "0"
+		if *c.Precision > 0 {
+			numFmt += "." + strings.Repeat("0", *c.Precision)
+		}
+		style, _ := f.NewStyle(&excelize.Style{CustomNumFmt: &numFmt})
+		valueStyles[*c.Precision] = style
+		return style
+	}
+
+	sw.SetColWidth(1, 2, 24)
+	sw.SetColWidth(3, 12, 16)
+	sw.SetColWidth(4, 4, 20)
+	sw.SetColWidth(6, 6, 20)
+
+	period := fmt.Sprintf("Periode: %s s/d %s (%s)",
+		start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04"), e.Zona.Label)
+	sw.SetRow("A1", []interface{}{excelize.Cell{StyleID: headerStyle, Value: "Ringkasan"}, period})
+
+	headers := []interface{}{}
+	for _, h := range []string{"Device", "Sensor", "Min", fmt.Sprintf("Waktu Min (%s)", e.Zona.Label),
+		"Max", fmt.Sprintf("Waktu Max (%s)", e.Zona.Label), "Rata-rata", "Std Deviasi",
+		"Jumlah Data", "Interval Lapor (detik)", "Interval Hilang"} {
+		headers = append(headers, excelize.Cell{StyleID: headerStyle, Value: h})
+	}
+	sw.SetRow("A3", headers)
+
+	rowNum := 4
+	for _, d := range e.Devices {
+		interval := config.DeviceHealth.intervalFor(d.ID)
+		expected := expectedSlots(start, end, interval)
+
+		for _, c := range d.Columns {
+			style := valueStyle(c)
+			row := []interface{}{d.ID, c.Label}
+			if s, ok := summaries[wideKey(d.ID, c.Code)]; ok {
+				var stddev interface{}
+				if s.StdDev.Valid {
+					stddev = excelize.Cell{StyleID: style, Value: s.StdDev.Float64}
+				}
+				row = append(row,
+					excelize.Cell{StyleID: style, Value: s.Min},
+					excelize.Cell{StyleID: timeStyle, Value: e.Zona.FromDatabase(s.MinAt)},
+					excelize.Cell{StyleID: style, Value: s.Max},
+					excelize.Cell{StyleID: timeStyle, Value: e.Zona.FromDatabase(s.MaxAt)},
+					excelize.Cell{StyleID: style, Value: s.Avg},
+					stddev,
+					excelize.Cell{StyleID: countStyle, Value: s.Count},
+					excelize.Cell{StyleID: countStyle, Value: int64(interval.Seconds())},
+					excelize.Cell{StyleID: countStyle, Value: max(expected-s.FilledSlots, 0)},
+				)
+			} else {
+				// Tidak ada data sama sekali: semua slot hilang
+				row = append(row, nil, nil, nil, nil, nil, nil,
+					excelize.Cell{StyleID: countStyle, Value: 0},
+					excelize.Cell{StyleID: countStyle, Value: int64(interval.Seconds())},
+					excelize.Cell{StyleID: countStyle, Value: expected},
+				)
+			}
+
+			cell, _ := excelize.CoordinatesToCellName(1, rowNum)
+			if err := sw.SetRow(cell, row); err != nil {
+				return err
+			}
+			rowNum++
+		}
+	}
+	return sw.Flush()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Batas ukuran request ingest
+const (
+	maxIngestBatch     = 5000
+	maxIngestBodyBytes = 8 << 20
+)
+
+// Satu baris pembacaan sensor dari logger
+type IngestReading struct {
+	DeviceUniqueID string   `json:"device_unique_id"`
+	ParameterName  string   `json:"parameter_name"`
+	Value          *float64 `json:"value"`
+	RecordedAt     string   `json:"recorded_at"`
+}
+
+// Hasil per baris agar device tahu baris mana yang harus dikirim ulang
+type IngestResult struct {
+	Index          int    `json:"index"`
+	DeviceUniqueID string `json:"device_unique_id"`
+	ParameterName  string `json:"parameter_name"`
+	Status         string `json:"status"` // ok | invalid | forbidden | failed
+	Error          string `json:"error,omitempty"`
+}
+
+// Parse recorded_at: RFC3339 (dengan offset) atau "YYYY-MM-DD HH:MM:SS" yang dianggap WIB
+func parseRecordedAt(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("recorded_at wajib diisi")
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.In(lokasiWIB), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, lokasiWIB); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("format recorded_at tidak valid: %s", s)
+}
+
+// Validasi satu baris, kembalikan waktu yang sudah di-parse
+func validateReading(rd IngestReading) (time.Time, error) {
+	if strings.TrimSpace(rd.DeviceUniqueID) == "" {
+		return time.Time{}, fmt.Errorf("device_unique_id wajib diisi")
+	}
+	if strings.TrimSpace(rd.ParameterName) == "" {
+		return time.Time{}, fmt.Errorf("parameter_name wajib diisi")
+	}
+	if rd.Value == nil {
+		return time.Time{}, fmt.Errorf("value wajib diisi")
+	}
+	if math.IsNaN(*rd.Value) || math.IsInf(*rd.Value, 0) {
+		return time.Time{}, fmt.Errorf("value harus angka valid")
+	}
+	t, err := parseRecordedAt(rd.RecordedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.After(time.Now().Add(5 * time.Minute)) {
+		return time.Time{}, fmt.Errorf("recorded_at tidak boleh di masa depan")
+	}
+	return t, nil
+}
+
+// Body boleh berupa satu objek atau array objek
+func decodeIngestBody(body []byte) ([]IngestReading, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, fmt.Errorf("body kosong")
+	}
+	if body[0] == '[' {
+		var readings []IngestReading
+		if err := json.Unmarshal(body, &readings); err != nil {
+			return nil, err
+		}
+		return readings, nil
+	}
+	var single IngestReading
+	if err := json.Unmarshal(body, &single); err != nil {
+		return nil, err
+	}
+	return []IngestReading{single}, nil
+}
+
+// Handler: POST /api/ingest
+func ingestSensorData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "method harus POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxIngestBodyBytes)
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		respondError(w, "body terlalu besar atau tidak terbaca", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	readings, err := decodeIngestBody(buf.Bytes())
+	if err != nil {
+		respondError(w, "JSON tidak valid: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(readings) == 0 {
+		respondError(w, "tidak ada data untuk disimpan", http.StatusBadRequest)
+		return
+	}
+	if len(readings) > maxIngestBatch {
+		respondError(w, fmt.Sprintf("maksimal %d baris per request", maxIngestBatch), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Validasi semua baris dulu
+	identity := identityFromContext(r.Context())
+	results := make([]IngestResult, len(readings))
+	times := make([]time.Time, len(readings))
+	valid := 0
+	for i, rd := range readings {
+		results[i] = IngestResult{
+			Index:          i,
+			DeviceUniqueID: rd.DeviceUniqueID,
+			ParameterName:  rd.ParameterName,
+		}
+		t, err := validateReading(rd)
+		if err != nil {
+			results[i].Status = "invalid"
+			results[i].Error = err.Error()
+			continue
+		}
+		if !identity.CanAccessDevice(rd.DeviceUniqueID) {
+			results[i].Status = "forbidden"
+			results[i].Error = "token tidak punya akses ke device ini"
+			continue
+		}
+		times[i] = t
+		valid++
+	}
+
+	// Simpan baris valid dalam satu transaksi
+	if valid > 0 {
+		if err := insertReadings(readings, times, results); err != nil {
+			for i := range results {
+				if results[i].Status == "" {
+					results[i].Status = "failed"
+					results[i].Error = err.Error()
+				}
+			}
+		} else {
+			for i := range results {
+				if results[i].Status == "" {
+					results[i].Status = "ok"
+				}
+			}
+			liveHub.notify()
+		}
+	}
+
+	inserted := 0
+	for _, res := range results {
+		if res.Status == "ok" {
+			inserted++
+		}
+	}
+
+	resp := Response{
+		Status: inserted == len(readings),
+		Filter: "ingest",
+		Mode:   "batch",
+		Total:  inserted,
+		Data:   results,
+	}
+	if inserted < len(readings) {
+		resp.Message = fmt.Sprintf("%d dari %d baris gagal disimpan", len(readings)-inserted, len(readings))
+	}
+	respond(w, resp)
+}
+
+// Insert baris valid dengan COPY dalam satu transaksi
+func insertReadings(readings []IngestReading, times []time.Time, results []IngestResult) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyIn("sensor_logs", "device_unique_id", "parameter_name", "value", "recorded_at"))
+	if err != nil {
+		return err
+	}
+
+	for i, rd := range readings {
+		if results[i].Status != "" {
+			continue
+		}
+		if _, err := stmt.Exec(rd.DeviceUniqueID, rd.ParameterName, *rd.Value, times[i]); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Trigger NOTIFY per statement INSERT ke sensor_logs, dibuat jika belum ada
+// (CREATE OR REPLACE TRIGGER baru ada di PostgreSQL 14).
+// Payload konstan sehingga notifikasi dalam satu transaksi digabung Postgres.
+const sensorNotifySchema = `
+CREATE OR REPLACE FUNCTION notify_sensor_logs_insert() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('sensor_logs_insert', '');
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'sensor_logs_notify' AND tgrelid = 'sensor_logs'::regclass) THEN
+		CREATE TRIGGER sensor_logs_notify
+			AFTER INSERT ON sensor_logs
+			FOR EACH STATEMENT EXECUTE FUNCTION notify_sensor_logs_insert();
+	END IF;
+END
+$$;
+CREATE TABLE IF NOT EXISTS live_hub_cursor (
+	name       TEXT PRIMARY KEY,
+	last_id    BIGINT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+`
+
+const (
+	liveChannel      = "sensor_logs_insert"
+	livePollInterval = 5 * time.Second
+	liveFetchBatch   = 5000
+	liveSubBuffer    = 1024
+
+	// Id yang terlewat (transaksi belum commit saat fetch) dicek ulang selama ini
+	liveLagWindow = time.Minute
+	liveMaxGaps   = 10000
+
+	// Baris cursor hub di live_hub_cursor
+	liveCursorName = "hub"
+)
+
+// Baris baru dari sensor_logs (waktu masih WIB tanpa zona)
+type liveReading struct {
+	ID             int
+	DeviceUniqueID string
+	ParameterName  string
+	Value          float64
+	RecordedAt     time.Time
+	Cursor         int // posisi resume: semua id <= Cursor sudah terkirim sebelum baris ini
+}
+
+// Format ke SensorData di zona waktu subscriber
+func (lr liveReading) SensorData(zona Zona) SensorData {
+	return SensorData{
+		ID:             lr.ID,
+		DeviceUniqueID: lr.DeviceUniqueID,
+		ParameterName:  lr.ParameterName,
+		Value:          lr.Value,
+		RecordedAt:     zona.FromDatabase(lr.RecordedAt).Format("2006-01-02 15:04:05"),
+	}
+}
+
+// Parameter "*" berarti semua parameter device
+const allParams = "*"
+
+// Subscriber live: pasangan device -> parameter yang diikuti
+type liveSub struct {
+	mu     sync.Mutex
+	pairs  map[string]map[string]bool
+	ch     chan liveReading
+	closed bool
+}
+
+// Subscriber baru; params kosong = semua parameter tiap device
+func newLiveSub(devices, params []string) *liveSub {
+	s := &liveSub{
+		pairs: map[string]map[string]bool{},
+		ch:    make(chan liveReading, liveSubBuffer),
+	}
+	if len(params) == 0 {
+		params = []string{allParams}
+	}
+	for _, d := range devices {
+		for _, p := range params {
+			s.add(d, p)
+		}
+	}
+	return s
+}
+
+// Ikuti pasangan device/parameter
+func (s *liveSub) add(device, param string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pairs[device] == nil {
+		s.pairs[device] = map[string]bool{}
+	}
+	s.pairs[device][param] = true
+}
+
+// Berhenti mengikuti pasangan device/parameter ("*" = semua parameter device)
+func (s *liveSub) remove(device, param string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if param == allParams {
+		delete(s.pairs, device)
+		return
+	}
+	delete(s.pairs[device], param)
+	if len(s.pairs[device]) == 0 {
+		delete(s.pairs, device)
+	}
+}
+
+// Daftar pasangan yang sedang diikuti
+func (s *liveSub) list() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[string][]string{}
+	for d, params := range s.pairs {
+		for p := range params {
+			out[d] = append(out[d], p)
+		}
+	}
+	return out
+}
+
+func (s *liveSub) wants(lr liveReading) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	params := s.pairs[lr.DeviceUniqueID]
+	return params[allParams] || params[lr.ParameterName]
+}
+
+// Hub: ambil baris baru (dipicu NOTIFY atau polling) lalu kirim ke subscriber
+type readingHub struct {
+	mu       sync.Mutex
+	subs     map[*liveSub]bool
+	handlers []func([]liveReading)
+	lastID   int
+	gaps     map[int64]time.Time // id di bawah lastID yang belum terlihat -> kapan terlewat
+	safeID   int                 // lastID, atau sebelum celah tertua (dibaca subscriber, pakai mu)
+	savedID  int
+	wake     chan struct{}
+}
+
+var liveHub = &readingHub{
+	subs: map[*liveSub]bool{},
+	gaps: map[int64]time.Time{},
+	wake: make(chan struct{}, 1),
+}
+
+func (h *readingHub) subscribe(s *liveSub) {
+	h.mu.Lock()
+	h.subs[s] = true
+	h.mu.Unlock()
+}
+
+// Daftarkan consumer internal (mis. alert engine) yang menerima setiap batch.
+// Berbeda dengan subscriber, handler tidak pernah diputus.
+func (h *readingHub) handle(fn func([]liveReading)) {
+	h.mu.Lock()
+	h.handlers = append(h.handlers, fn)
+	h.mu.Unlock()
+}
+
+func (h *readingHub) unsubscribe(s *liveSub) {
+	h.mu.Lock()
+	if h.subs[s] {
+		delete(h.subs, s)
+		s.closed = true
+		close(s.ch)
+	}
+	h.mu.Unlock()
+}
+
+// Picu fetch segera (mis. setelah ingest di proses ini)
+func (h *readingHub) notify() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Jalankan listener NOTIFY dengan polling sebagai cadangan.
+// Lanjut dari cursor tersimpan agar baris yang masuk saat proses mati tetap sampai ke handler.
+func (h *readingHub) run() {
+	err := db.QueryRow(`SELECT last_id FROM live_hub_cursor WHERE name = $1`, liveCursorName).Scan(&h.lastID)
+	if err == sql.ErrNoRows {
+		err = db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM sensor_logs`).Scan(&h.lastID)
+	}
+	if err != nil {
+		log.Println("live hub:", err)
+	}
+	h.savedID = h.lastID
+	h.setSafeID()
+
+	listener := pq.NewListener(config.DatabaseDSN, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("live hub listener:", err)
+		}
+	})
+	if err := listener.Listen(liveChannel); err != nil {
+		log.Println("live hub: LISTEN gagal, pakai polling:", err)
+	}
+
+	ticker := time.NewTicker(livePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-listener.Notify:
+		case <-ticker.C:
+		case <-h.wake:
+		}
+		h.fetch()
+	}
+}
+
+// Ambil baris dengan id > lastID, ditambah id terlewat yang baru commit, lalu sebarkan.
+// Id yang dilompati (transaksi lain belum commit) dicatat sebagai celah dan dicek ulang
+// selama liveLagWindow; baris yang sudah terkirim tidak dikirim dua kali.
+func (h *readingHub) fetch() {
+	h.mu.Lock()
+	idle := len(h.subs) == 0 && len(h.handlers) == 0
+	handlers := h.handlers
+	h.mu.Unlock()
+
+	// Tanpa subscriber cukup majukan lastID
+	if idle {
+		var maxID int
+		if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM sensor_logs`).Scan(&maxID); err == nil {
+			h.lastID = maxID
+			h.gaps = map[int64]time.Time{}
+			h.setSafeID()
+		}
+		return
+	}
+
+	now := time.Now()
+	for {
+		gaps := make([]int64, 0, len(h.gaps))
+		for id, since := range h.gaps {
+			if now.Sub(since) > liveLagWindow {
+				delete(h.gaps, id)
+				continue
+			}
+			gaps = append(gaps, id)
+		}
+
+		rows, err := db.Query(`
+			SELECT id, device_unique_id, parameter_name, value, recorded_at
+			FROM sensor_logs
+			WHERE id > $1 OR id = ANY($3)
+			ORDER BY id
+			LIMIT $2
+		`, h.lastID, liveFetchBatch, pq.Array(gaps))
+		if err != nil {
+			log.Println("live hub fetch:", err)
+			return
+		}
+
+		var batch []liveReading
+		scanned := 0
+		for rows.Next() {
+			scanned++
+			var lr liveReading
+			if err := rows.Scan(&lr.ID, &lr.DeviceUniqueID, &lr.ParameterName, &lr.Value, &lr.RecordedAt); err != nil {
+				continue
+			}
+			if lr.ID <= h.lastID {
+				// Baris terlambat commit; selain celah berarti sudah terkirim
+				if _, late := h.gaps[int64(lr.ID)]; !late {
+					continue
+				}
+				delete(h.gaps, int64(lr.ID))
+			} else {
+				for missing := h.lastID + 1; missing < lr.ID && len(h.gaps) < liveMaxGaps; missing++ {
+					h.gaps[int64(missing)] = now
+				}
+				h.lastID = lr.ID
+			}
+			batch = append(batch, lr)
+		}
+		rows.Close()
+
+		// Resume dari Cursor tidak melewati celah yang mungkin masih commit
+		safe := h.setSafeID()
+		for i := range batch {
+			batch[i].Cursor = min(batch[i].ID, safe)
+		}
+
+		if len(batch) > 0 {
+			h.broadcast(batch)
+			for _, fn := range handlers {
+				fn(batch)
+			}
+		}
+
+		if scanned < liveFetchBatch {
+			break
+		}
+	}
+
+	if len(handlers) > 0 {
+		h.saveCursor()
+	}
+}
+
+// Posisi aman hub: lastID, atau sebelum celah tertua yang masih dicek ulang
+func (h *readingHub) cursor() int {
+	cursor := h.lastID
+	for id := range h.gaps {
+		if int(id)-1 < cursor {
+			cursor = int(id) - 1
+		}
+	}
+	return cursor
+}
+
+// Catat posisi aman untuk subscriber baru
+func (h *readingHub) setSafeID() int {
+	safe := h.cursor()
+	h.mu.Lock()
+	h.safeID = safe
+	h.mu.Unlock()
+	return safe
+}
+
+// Posisi aman saat ini: id di atasnya mungkin belum semua terkirim ke subscriber
+func (h *readingHub) resumeID() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.safeID
+}
+
+// Simpan posisi hub: sebelum celah tertua, agar restart juga mengecek ulang celah
+func (h *readingHub) saveCursor() {
+	cursor := h.cursor()
+	if cursor == h.savedID {
+		return
+	}
+	if _, err := db.Exec(`
+		INSERT INTO live_hub_cursor (name, last_id) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET last_id = EXCLUDED.last_id, updated_at = NOW()
+	`, liveCursorName, cursor); err != nil {
+		log.Println("live hub cursor:", err)
+		return
+	}
+	h.savedID = cursor
+}
+
+// Kirim ke subscriber; subscriber yang terlalu lambat diputus
+// (client bisa lanjut lagi dengan Last-Event-ID)
+func (h *readingHub) broadcast(batch []liveReading) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		for _, lr := range batch {
+			if !s.wants(lr) {
+				continue
+			}
+			select {
+			case s.ch <- lr:
+			default:
+				delete(h.subs, s)
+				s.closed = true
+				close(s.ch)
+			}
+			if s.closed {
+				break
+			}
+		}
+	}
+}
+
+// Backfill baris lama untuk resume / request client (urut id naik)
+func fetchReadingsSince(devices, params []string, afterID, limit int) ([]liveReading, error) {
+	query := `
+		SELECT id, device_unique_id, parameter_name, value, recorded_at
+		FROM sensor_logs
+		WHERE id > $1
+		  AND device_unique_id = ANY($2)
+		  AND ($3::text[] IS NULL OR parameter_name = ANY($3))
+		ORDER BY id
+		LIMIT $4
+	`
+	var paramArg interface{}
+	if len(params) > 0 {
+		paramArg = pq.Array(params)
+	}
+	rows, err := db.Query(query, afterID, pq.Array(devices), paramArg, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []liveReading
+	for rows.Next() {
+		var lr liveReading
+		if err := rows.Scan(&lr.ID, &lr.DeviceUniqueID, &lr.ParameterName, &lr.Value, &lr.RecordedAt); err != nil {
+			continue
+		}
+		readings = append(readings, lr)
+	}
+	return readings, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadingHubCursor(t *testing.T) {
+	h := &readingHub{lastID: 100, gaps: map[int64]time.Time{}}
+	if got := h.cursor(); got != 100 {
+		t.Errorf("tanpa celah = %d, want 100", got)
+	}
+
+	h.gaps[97] = time.Now()
+	h.gaps[95] = time.Now()
+	if got := h.cursor(); got != 94 {
+		t.Errorf("dengan celah = %d, want 94", got)
+	}
+	if got := h.setSafeID(); got != 94 || h.resumeID() != 94 {
+		t.Errorf("setSafeID = %d, resumeID = %d, want 94", got, h.resumeID())
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestParsePercentile(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"median", "0.5", true},
+		{"p50", "0.50", true},
+		{"p1", "0.01", true},
+		{"p5", "0.05", true},
+		{"p95", "0.95", true},
+		{"p99", "0.99", true},
+		{"p0", "", false},
+		{"p100", "", false},
+		{"p", "", false},
+		{"px", "", false},
+		{"p-5", "", false},
+		{"q50", "", false},
+		{"avg", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parsePercentile(tt.in)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parsePercentile(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ukuran halaman maksimal data mentah, sekaligus default jika limit tidak diisi
+const maxPageSize = 20000
+
+// Flush ke client setiap sekian baris saat streaming
+const streamFlushRows = 1000
+
+const cursorLayout = "2006-01-02 15:04:05.999999"
+
+// Metadata halaman data mentah di Response
+type PageInfo struct {
+	Limit      int    `json:"limit"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// Keyset pagination data mentah pada (recorded_at, id), terbaru dulu.
+// Cursor menyimpan recorded_at (waktu database) dan id baris terakhir halaman sebelumnya.
+type pageRequest struct {
+	size   int
+	cursor string
+	at     string
+	id     int64
+	ndjson bool // format=ndjson
+}
+
+func parsePageRequest(cursor string, limit int) (pageRequest, error) {
+	p := pageRequest{size: maxPageSize, cursor: cursor}
+	if limit > 0 && limit < maxPageSize {
+		p.size = limit
+	}
+	if cursor == "" {
+		return p, nil
+	}
+
+	invalid := fmt.Errorf("cursor tidak valid")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return p, invalid
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return p, invalid
+	}
+	if _, err := time.Parse(cursorLayout, at); err != nil {
+		return p, invalid
+	}
+	if p.id, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return p, invalid
+	}
+	p.at = at
+	return p, nil
+}
+
+func encodeCursor(at time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(at.Format(cursorLayout) + "|" + strconv.Itoa(id)))
+}
+
+// Filter cursor (untuk WHERE) dan ORDER BY/LIMIT halaman; args ikut diperpanjang.
+// Query harus memilih pageKeyColumn setelah kolom SensorData.
+func (p pageRequest) clauses(args *[]interface{}) (where, orderLimit string) {
+	if p.at != "" {
+		*args = append(*args, p.at, p.id)
+		where = fmt.Sprintf("AND (recorded_at, id) < ($%d::timestamp, $%d)", len(*args)-1, len(*args))
+	}
+	*args = append(*args, p.size+1)
+	orderLimit = fmt.Sprintf("ORDER BY recorded_at DESC, id DESC LIMIT $%d", len(*args))
+	return where, orderLimit
+}
+
+const pageKeyColumn = "recorded_at AS page_key"
+
+// Envelope Response tanpa field yang baru diketahui setelah semua baris terkirim
+type streamEnvelope struct {
+	Response
+	Status  *bool       `json:"status,omitempty"`
+	Total   *int        `json:"total,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Page    *PageInfo   `json:"page,omitempty"`
+}
+
+// Penutup stream: status, total dan metadata halaman
+type streamTrailer struct {
+	Status  bool      `json:"status"`
+	Total   int       `json:"total"`
+	Message string    `json:"message,omitempty"`
+	Page    *PageInfo `json:"page,omitempty"`
+}
+
+// Kirim satu halaman langsung dari rows tanpa menampung semua baris di memori.
+// JSON: envelope Response biasa, dengan status/total/page ditulis setelah array data.
+// NDJSON: baris pertama envelope, lalu satu baris per data, lalu baris penutup (status/total/page).
+// Baris ekstra (size+1) hanya menandai masih ada halaman berikutnya.
+func (p pageRequest) respond(w http.ResponseWriter, rows *sql.Rows, resp Response) {
+	header, err := json.Marshal(streamEnvelope{Response: resp})
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if p.ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	bw := bufio.NewWriterSize(w, 32<<10)
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(bw)
+
+	if p.ndjson {
+		bw.Write(header)
+		bw.WriteByte('\n')
+	} else {
+		bw.Write(header[:len(header)-1])
+		if len(header) > 2 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString(`"data":[`)
+	}
+
+	info := &PageInfo{Limit: p.size, Cursor: p.cursor}
+	total := 0
+	var last SensorData
+	var lastAt time.Time
+	for rows.Next() {
+		var s SensorData
+		var at time.Time
+		if err := rows.Scan(&s.ID, &s.DeviceUniqueID, &s.ParameterName, &s.Value, &s.RecordedAt, &at); err != nil {
+			continue
+		}
+		if total == p.size {
+			info.HasMore = true
+			break
+		}
+		if total > 0 && !p.ndjson {
+			bw.WriteByte(',')
+		}
+		if err := enc.Encode(s); err != nil {
+			return // client terputus
+		}
+		total++
+		last, lastAt = s, at
+		if total%streamFlushRows == 0 {
+			bw.Flush()
+			rc.Flush()
+		}
+	}
+	if info.HasMore {
+		info.NextCursor = encodeCursor(lastAt, last.ID)
+	}
+
+	// Status HTTP sudah terkirim; error di tengah jalan dilaporkan di penutup
+	trailer := streamTrailer{Status: true, Total: total, Message: resp.Message, Page: info}
+	if err := rows.Err(); err != nil {
+		log.Println("stream rows:", err)
+		trailer.Status, trailer.Message, trailer.Page = false, err.Error(), nil
+	}
+	tail, _ := json.Marshal(trailer)
+	if p.ndjson {
+		bw.Write(tail)
+	} else {
+		bw.WriteString("],")
+		bw.Write(tail[1:])
+	}
+	bw.WriteByte('\n')
+	bw.Flush()
+}
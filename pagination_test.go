@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		at time.Time
+		id int
+	}{
+		{time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC), 1},
+		{time.Date(2026, 3, 1, 23, 30, 0, 123456000, time.UTC), 98765},
+		{time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC), 1 << 40},
+	}
+	for _, tt := range tests {
+		cursor := encodeCursor(tt.at, tt.id)
+		p, err := parsePageRequest(cursor, 0)
+		if err != nil {
+			t.Fatalf("parsePageRequest(%s): %v", cursor, err)
+		}
+		at, _ := time.Parse(cursorLayout, p.at)
+		if !at.Equal(tt.at) || p.id != int64(tt.id) || p.cursor != cursor {
+			t.Errorf("round trip %v/%d = %s/%d", tt.at, tt.id, p.at, p.id)
+		}
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	enc := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name     string
+		cursor   string
+		limit    int
+		wantSize int
+		wantErr  bool
+	}{
+		{"default", "", 0, maxPageSize, false},
+		{"limit kecil", "", 100, 100, false},
+		{"limit di atas maksimal", "", maxPageSize + 1, maxPageSize, false},
+		{"bukan base64", "!!!", 0, 0, true},
+		{"tanpa pemisah", enc("2026-01-01 00:00:00"), 0, 0, true},
+		{"waktu salah", enc("kemarin|5"), 0, 0, true},
+		{"id salah", enc("2026-01-01 00:00:00|abc"), 0, 0, true},
+	}
+	for _, tt := range tests {
+		p, err := parsePageRequest(tt.cursor, tt.limit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && p.size != tt.wantSize {
+			t.Errorf("%s: size = %d, want %d", tt.name, p.size, tt.wantSize)
+		}
+	}
+}
+
+func TestPageClauses(t *testing.T) {
+	first, _ := parsePageRequest("", 50)
+	args := []interface{}{"device-1", "suhu"}
+	where, orderLimit := first.clauses(&args)
+	if where != "" {
+		t.Errorf("halaman pertama tanpa filter cursor, dapat %q", where)
+	}
+	if orderLimit != "ORDER BY recorded_at DESC, id DESC LIMIT $3" {
+		t.Errorf("orderLimit = %q", orderLimit)
+	}
+	// Satu baris ekstra untuk mendeteksi has_more
+	if !reflect.DeepEqual(args, []interface{}{"device-1", "suhu", 51}) {
+		t.Errorf("args = %v", args)
+	}
+
+	next, _ := parsePageRequest(encodeCursor(time.Date(2026, 3, 1, 10, 0, 0, 500000000, time.UTC), 42), 50)
+	args = []interface{}{"device-1"}
+	where, orderLimit = next.clauses(&args)
+	if where != "AND (recorded_at, id) < ($2::timestamp, $3)" {
+		t.Errorf("where = %q", where)
+	}
+	if orderLimit != "ORDER BY recorded_at DESC, id DESC LIMIT $4" {
+		t.Errorf("orderLimit = %q", orderLimit)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"device-1", "2026-03-01 10:00:00.5", int64(42), 51}) {
+		t.Errorf("args = %v", args)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kelas biaya endpoint
+const (
+	rateCheap     = "cheap"
+	rateExpensive = "expensive"
+)
+
+// Budget token bucket per menit
+type RateLimit struct {
+	PerMinute float64 `yaml:"per_minute"`
+	Burst     int     `yaml:"burst"`
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Token bucket per key (API key atau IP)
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // token per detik
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		rate:    limit.PerMinute / 60,
+		burst:   float64(limit.Burst),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Ambil satu token. Kembalikan sisa token dan waktu tunggu jika ditolak.
+func (l *rateLimiter) take(key string, now time.Time) (ok bool, remaining int, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// Kembalikan satu token yang sudah diambil (request ditolak bucket lain)
+func (l *rateLimiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(l.burst, b.tokens+1)
+	}
+}
+
+// Detik sampai bucket penuh lagi
+func (l *rateLimiter) resetAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	return time.Duration((l.burst - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Buang bucket yang sudah penuh kembali (tidak dipakai lama)
+func (l *rateLimiter) cleanup(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Diisi sekali saat startup, sebelum server menerima request
+var rateLimiters map[string]*rateLimiter
+
+// Buat limiter sesuai config dan jalankan pembersih bucket
+func initRateLimiters() {
+	rateLimiters = map[string]*rateLimiter{
+		rateCheap:     newRateLimiter(config.RateLimitCheap),
+		rateExpensive: newRateLimiter(config.RateLimitExpensive),
+	}
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			for _, l := range rateLimiters {
+				l.cleanup(now)
+			}
+		}
+	}()
+}
+
+// Tentukan kelas biaya request: latest/now murah, bulan/rentang/export mahal
+func rateClass(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/api/export/") {
+		return rateExpensive
+	}
+	q := r.URL.Query()
+	if q.Get("mode") == "latest" || q.Get("periode") == "now" {
+		return rateCheap
+	}
+	if q.Get("bulan") != "" || q.Get("periode") == "bulan" || q.Get("from") != "" {
+		return rateExpensive
+	}
+	return rateCheap
+}
+
+// IP client (header proxy hanya dipercaya jika diaktifkan di config)
+func clientIP(r *http.Request) string {
+	if config.TrustProxyHeaders {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return realIP
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Hasil limit per IP, diteruskan ke limit per key setelah auth
+type rateState struct {
+	limiter   *rateLimiter
+	class     string
+	ipKey     string
+	remaining int
+	reset     time.Duration
+}
+
+// Header limit untuk request yang lolos
+func setRateHeaders(w http.ResponseWriter, limiter *rateLimiter, remaining int, reset time.Duration) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(int(limiter.burst)))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+}
+
+// Response 429 untuk bucket yang habis
+func rejectRateLimit(w http.ResponseWriter, limiter *rateLimiter, class, key string, retryAfter time.Duration) {
+	setRateHeaders(w, limiter, 0, limiter.resetAfter(key))
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	respondError(w, fmt.Sprintf("Terlalu banyak request (%s), coba lagi nanti", class), http.StatusTooManyRequests)
+}
+
+// Middleware sebelum auth: token bucket per IP
+func ipRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := rateClass(r)
+		limiter := rateLimiters[class]
+		if limiter == nil || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		state := &rateState{limiter: limiter, class: class, ipKey: "ip:" + clientIP(r)}
+		ok, left, retryAfter := limiter.take(state.ipKey, time.Now())
+		if !ok {
+			rejectRateLimit(w, limiter, class, state.ipKey, retryAfter)
+			return
+		}
+		state.remaining, state.reset = left, limiter.resetAfter(state.ipKey)
+		setRateHeaders(w, limiter, state.remaining, state.reset)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitKey, state)))
+	})
+}
+
+// Middleware setelah auth: token bucket per API key / token statis.
+// Jika bucket key habis, token IP yang sudah diambil dikembalikan.
+func keyRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, _ := r.Context().Value(rateLimitKey).(*rateState)
+		id := identityFromContext(r.Context())
+		if state == nil || id == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "token:" + id.Name
+		if id.KeyID != 0 {
+			key = fmt.Sprintf("key:%d", id.KeyID)
+		}
+		ok, left, retryAfter := state.limiter.take(key, time.Now())
+		if !ok {
+			state.limiter.refund(state.ipKey)
+			rejectRateLimit(w, state.limiter, state.class, key, retryAfter)
+			return
+		}
+		setRateHeaders(w, state.limiter, min(state.remaining, left), max(state.reset, state.limiter.resetAfter(key)))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	l := newRateLimiter(RateLimit{PerMinute: 60, Burst: 3})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		at        time.Duration
+		wantOK    bool
+		wantLeft  int
+		wantRetry time.Duration
+	}{
+		{"burst 1", 0, true, 2, 0},
+		{"burst 2", 0, true, 1, 0},
+		{"burst 3", 0, true, 0, 0},
+		{"habis", 0, false, 0, time.Second},
+		{"setengah token", 500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+		{"terisi satu", time.Second, true, 0, 0},
+		{"penuh lagi, tidak melebihi burst", time.Hour, true, 2, 0},
+	}
+	for _, tt := range tests {
+		ok, left, retry := l.take("ip:1", now.Add(tt.at))
+		if ok != tt.wantOK || left != tt.wantLeft || retry != tt.wantRetry {
+			t.Errorf("%s: take = %v, %d, %v; want %v, %d, %v", tt.name, ok, left, retry, tt.wantOK, tt.wantLeft, tt.wantRetry)
+		}
+	}
+
+	// Bucket tiap key terpisah
+	if ok, left, _ := l.take("ip:2", now); !ok || left != 2 {
+		t.Errorf("key lain = %v, %d; want true, 2", ok, left)
+	}
+}
+
+func TestRateLimiterRefundAndCleanup(t *testing.T) {
+	l := newRateLimiter(RateLimit{PerMinute: 60, Burst: 2})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l.take("ip:1", now)
+	l.refund("ip:1")
+	l.refund("ip:1") // tidak melebihi burst
+	if ok, left, _ := l.take("ip:1", now); !ok || left != 1 {
+		t.Errorf("setelah refund = %v, %d; want true, 1", ok, left)
+	}
+
+	l.cleanup(now)
+	if _, ok := l.buckets["ip:1"]; !ok {
+		t.Error("bucket belum penuh tidak boleh dibuang")
+	}
+	l.cleanup(now.Add(time.Minute))
+	if _, ok := l.buckets["ip:1"]; ok {
+		t.Error("bucket penuh harus dibuang")
+	}
+}
+
+func TestRateLimitMiddlewareRefundsIP(t *testing.T) {
+	saved := rateLimiters
+	defer func() { rateLimiters = saved }()
+	rateLimiters = map[string]*rateLimiter{rateCheap: newRateLimiter(RateLimit{PerMinute: 1, Burst: 2})}
+
+	// Dua key berbeda dari IP yang sama; key pertama sudah habis
+	rateLimiters[rateCheap].take("key:1", time.Now())
+	rateLimiters[rateCheap].take("key:1", time.Now())
+
+	handler := func(keyID int) http.Handler {
+		inner := keyRateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		return ipRateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inner.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), &Identity{Name: "test", KeyID: keyID})))
+		}))
+	}
+	request := func(keyID int) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/get-data?mode=latest", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler(keyID).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request(1); code != http.StatusTooManyRequests {
+		t.Fatalf("key habis = %d, want 429", code)
+	}
+	// Token IP dari request yang ditolak harus dikembalikan
+	for i := 0; i < 2; i++ {
+		if code := request(2); code != http.StatusOK {
+			t.Fatalf("request %d key lain = %d, want 200", i+1, code)
+		}
+	}
+	if code := request(2); code != http.StatusTooManyRequests {
+		t.Errorf("IP habis = %d, want 429", code)
+	}
+}
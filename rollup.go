@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Rollup per jam dan per hari (bucket dalam waktu database/WIB).
+// Setiap INSERT ke sensor_logs menandai bucket jam yang tersentuh di sensor_rollup_dirty,
+// termasuk data telat; worker menghitung ulang bucket itu dari data mentah.
+// Selama bucket masih dirty, query membaca bucket itu dari sensor_logs.
+const rollupSchema = `
+CREATE TABLE IF NOT EXISTS sensor_rollup_1h (
+	device_unique_id TEXT NOT NULL,
+	parameter_name   TEXT NOT NULL,
+	bucket           TIMESTAMP NOT NULL,
+	min_value        DOUBLE PRECISION NOT NULL,
+	max_value        DOUBLE PRECISION NOT NULL,
+	sum_value        DOUBLE PRECISION NOT NULL,
+	sample_count     BIGINT NOT NULL,
+	min_id           BIGINT NOT NULL,
+	PRIMARY KEY (device_unique_id, parameter_name, bucket)
+);
+CREATE TABLE IF NOT EXISTS sensor_rollup_1d (
+	device_unique_id TEXT NOT NULL,
+	parameter_name   TEXT NOT NULL,
+	bucket           TIMESTAMP NOT NULL,
+	min_value        DOUBLE PRECISION NOT NULL,
+	max_value        DOUBLE PRECISION NOT NULL,
+	sum_value        DOUBLE PRECISION NOT NULL,
+	sample_count     BIGINT NOT NULL,
+	min_id           BIGINT NOT NULL,
+	PRIMARY KEY (device_unique_id, parameter_name, bucket)
+);
+CREATE SEQUENCE IF NOT EXISTS sensor_rollup_dirty_version;
+CREATE TABLE IF NOT EXISTS sensor_rollup_dirty (
+	device_unique_id TEXT NOT NULL,
+	parameter_name   TEXT NOT NULL,
+	bucket           TIMESTAMP NOT NULL,
+	version          BIGINT NOT NULL DEFAULT nextval('sensor_rollup_dirty_version'),
+	PRIMARY KEY (device_unique_id, parameter_name, bucket)
+);
+CREATE OR REPLACE FUNCTION mark_sensor_rollup_dirty() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO sensor_rollup_dirty (device_unique_id, parameter_name, bucket)
+	SELECT DISTINCT device_unique_id, parameter_name, DATE_TRUNC('hour', recorded_at)
+	FROM new_rows
+	ON CONFLICT (device_unique_id, parameter_name, bucket)
+	DO UPDATE SET version = nextval('sensor_rollup_dirty_version');
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+`
+
+const (
+	rollupInterval = 30 * time.Second
+	rollupBatch    = 1000
+)
+
+// Pasang trigger dirty, lalu tandai bucket data lama sebagai dirty per batch id
+func seedRollups() error {
+	return installSensorTrigger(sensorTrigger{
+		name: "sensor_logs_rollup_dirty",
+		create: `CREATE TRIGGER sensor_logs_rollup_dirty
+			AFTER INSERT ON sensor_logs
+			REFERENCING NEW TABLE AS new_rows
+			FOR EACH STATEMENT EXECUTE FUNCTION mark_sensor_rollup_dirty()`,
+		backfill: `INSERT INTO sensor_rollup_dirty (device_unique_id, parameter_name, bucket)
+			SELECT DISTINCT device_unique_id, parameter_name, DATE_TRUNC('hour', recorded_at)
+			FROM sensor_logs
+			WHERE id > $1 AND id <= $2
+			ON CONFLICT DO NOTHING`,
+	})
+}
+
+// Worker: proses antrian bucket dirty sampai habis, lalu tunggu interval berikutnya
+func rollupWorker() {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := processRollupBatch()
+			if err != nil {
+				log.Println("rollup:", err)
+				break
+			}
+			if n < rollupBatch {
+				break
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// Hitung ulang satu batch bucket jam dirty beserta bucket harinya.
+// Tanda dirty hanya dihapus jika versinya belum berubah (tidak ada INSERT baru sejak dibaca).
+func processRollupBatch() (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT device_unique_id, parameter_name, bucket::text, version
+		FROM sensor_rollup_dirty
+		ORDER BY bucket
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, rollupBatch)
+	if err != nil {
+		return 0, err
+	}
+	var devices, params, buckets []string
+	var versions []int64
+	for rows.Next() {
+		var device, param, bucket string
+		var version int64
+		if err := rows.Scan(&device, &param, &bucket, &version); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		devices = append(devices, device)
+		params = append(params, param)
+		buckets = append(buckets, bucket)
+		versions = append(versions, version)
+	}
+	rows.Close()
+	if len(devices) == 0 {
+		return 0, nil
+	}
+	keys := []interface{}{pq.Array(devices), pq.Array(params), pq.Array(buckets)}
+
+	// Bucket jam dari data mentah; bucket yang datanya sudah terhapus ikut dibuang
+	if _, err := tx.Exec(`
+		WITH keys AS (
+			SELECT * FROM unnest($1::text[], $2::text[], $3::timestamp[])
+				AS k(device_unique_id, parameter_name, bucket)
+		),
+		fresh AS (
+			SELECT k.device_unique_id, k.parameter_name, k.bucket,
+			       MIN(s.value) AS min_value, MAX(s.value) AS max_value, SUM(s.value) AS sum_value,
+			       COUNT(*) AS sample_count, MIN(s.id) AS min_id
+			FROM keys k
+			JOIN sensor_logs s ON s.device_unique_id = k.device_unique_id
+			  AND s.parameter_name = k.parameter_name
+			  AND s.recorded_at >= k.bucket
+			  AND s.recorded_at <  k.bucket + INTERVAL '1 hour'
+			GROUP BY k.device_unique_id, k.parameter_name, k.bucket
+		),
+		removed AS (
+			DELETE FROM sensor_rollup_1h r
+			USING keys k
+			WHERE r.device_unique_id = k.device_unique_id
+			  AND r.parameter_name = k.parameter_name
+			  AND r.bucket = k.bucket
+			  AND NOT EXISTS (
+				SELECT 1 FROM fresh f
+				WHERE f.device_unique_id = k.device_unique_id
+				  AND f.parameter_name = k.parameter_name
+				  AND f.bucket = k.bucket
+			  )
+		)
+		INSERT INTO sensor_rollup_1h SELECT * FROM fresh
+		ON CONFLICT (device_unique_id, parameter_name, bucket) DO UPDATE SET
+			min_value = EXCLUDED.min_value, max_value = EXCLUDED.max_value, sum_value = EXCLUDED.sum_value,
+			sample_count = EXCLUDED.sample_count, min_id = EXCLUDED.min_id
+	`, keys...); err != nil {
+		return 0, err
+	}
+
+	// Bucket hari yang tersentuh, dari rollup jam
+	if _, err := tx.Exec(`
+		WITH days AS (
+			SELECT DISTINCT device_unique_id, parameter_name, DATE_TRUNC('day', bucket) AS bucket
+			FROM unnest($1::text[], $2::text[], $3::timestamp[]) AS k(device_unique_id, parameter_name, bucket)
+		),
+		fresh AS (
+			SELECT d.device_unique_id, d.parameter_name, d.bucket,
+			       MIN(h.min_value) AS min_value, MAX(h.max_value) AS max_value, SUM(h.sum_value) AS sum_value,
+			       SUM(h.sample_count)::bigint AS sample_count, MIN(h.min_id) AS min_id
+			FROM days d
+			JOIN sensor_rollup_1h h ON h.device_unique_id = d.device_unique_id
+			  AND h.parameter_name = d.parameter_name
+			  AND h.bucket >= d.bucket
+			  AND h.bucket <  d.bucket + INTERVAL '1 day'
+			GROUP BY d.device_unique_id, d.parameter_name, d.bucket
+		),
+		removed AS (
+			DELETE FROM sensor_rollup_1d r
+			USING days d
+			WHERE r.device_unique_id = d.device_unique_id
+			  AND r.parameter_name = d.parameter_name
+			  AND r.bucket = d.bucket
+			  AND NOT EXISTS (
+				SELECT 1 FROM fresh f
+				WHERE f.device_unique_id = d.device_unique_id
+				  AND f.parameter_name = d.parameter_name
+				  AND f.bucket = d.bucket
+			  )
+		)
+		INSERT INTO sensor_rollup_1d SELECT * FROM fresh
+		ON CONFLICT (device_unique_id, parameter_name, bucket) DO UPDATE SET
+			min_value = EXCLUDED.min_value, max_value = EXCLUDED.max_value, sum_value = EXCLUDED.sum_value,
+			sample_count = EXCLUDED.sample_count, min_id = EXCLUDED.min_id
+	`, keys...); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM sensor_rollup_dirty d
+		USING unnest($1::text[], $2::text[], $3::timestamp[], $4::bigint[])
+			AS k(device_unique_id, parameter_name, bucket, version)
+		WHERE d.device_unique_id = k.device_unique_id
+		  AND d.parameter_name = k.parameter_name
+		  AND d.bucket = k.bucket
+		  AND d.version = k.version
+	`, append(keys, pq.Array(versions))...); err != nil {
+		return 0, err
+	}
+
+	return len(devices), tx.Commit()
+}
+
+// Agregat yang bisa dihitung dari min/max/sum/count rollup
+var rollupAggs = map[string]string{
+	"high": "MAX(max_value)",
+	"low":  "MIN(min_value)",
+	"avg":  "SUM(sum_value) / SUM(sample_count)",
+}
+
+// Query ringkas dari rollup, dengan kolom dan urutan yang sama seperti query mentah
+// ($1 device, $2 parameter; start/end ekspresi SQL waktu database, end kosong = tanpa batas).
+// ok = false jika agregat, bucket atau zona waktu tidak bisa dilayani rollup.
+func rollupQuery(valueMode, defaultUnit, pgInterval, start, end string, zona Zona) (string, bool) {
+	agg, ok := rollupAggs[valueMode]
+	if !ok {
+		return "", false
+	}
+
+	// Bucket jam WIB hanya bisa dipetakan ke zona dengan selisih jam bulat
+	offset := zona.offsetFromDatabase()
+	if offset%time.Hour != 0 {
+		return "", false
+	}
+
+	daily := false
+	switch pgInterval {
+	case "":
+		daily = defaultUnit == "day"
+	case "1 hour", "6 hours":
+	case "1 day", "1 week":
+		daily = true
+	default:
+		return "", false // bucket di bawah 1 jam butuh data mentah
+	}
+
+	// Rollup hari hanya sejajar dengan hari di zona yang sama dengan WIB
+	parts := rollupHourParts(start, end)
+	if daily && offset == 0 {
+		parts = rollupDayParts(start, end)
+	}
+
+	groupExpr, labelExpr := bucketColumns(pgInterval, defaultUnit, zona.FromDatabaseExpr("bucket"))
+	return fmt.Sprintf(`
+		SELECT MIN(min_id) AS id, $1::text AS device_unique_id, $2::text AS parameter_name,
+		       ROUND((%s)::numeric, 2) AS value,
+		       %s AS recorded_at
+		FROM (%s) parts
+		GROUP BY %s
+		ORDER BY %s DESC
+	`, agg, labelExpr, parts, groupExpr, groupExpr), true
+}
+
+func rollupWindow(column, start, end string) string {
+	cond := fmt.Sprintf("%s >= %s", column, start)
+	if end != "" {
+		cond += fmt.Sprintf(" AND %s < %s", column, end)
+	}
+	return cond
+}
+
+// Bucket jam: rollup untuk bucket bersih, data mentah untuk bucket dirty
+func rollupHourParts(start, end string) string {
+	return fmt.Sprintf(`
+		SELECT r.bucket, r.min_value, r.max_value, r.sum_value, r.sample_count, r.min_id
+		FROM sensor_rollup_1h r
+		WHERE r.device_unique_id = $1 AND r.parameter_name = $2 AND %s
+		  AND NOT EXISTS (
+			SELECT 1 FROM sensor_rollup_dirty d
+			WHERE d.device_unique_id = $1 AND d.parameter_name = $2 AND d.bucket = r.bucket
+		  )
+		UNION ALL
+		SELECT d.bucket, MIN(s.value), MAX(s.value), SUM(s.value), COUNT(*), MIN(s.id)
+		FROM sensor_rollup_dirty d
+		JOIN sensor_logs s ON s.device_unique_id = d.device_unique_id
+		  AND s.parameter_name = d.parameter_name
+		  AND s.recorded_at >= d.bucket
+		  AND s.recorded_at <  d.bucket + INTERVAL '1 hour'
+		WHERE d.device_unique_id = $1 AND d.parameter_name = $2 AND %s
+		GROUP BY d.bucket`,
+		rollupWindow("r.bucket", start, end), rollupWindow("d.bucket", start, end))
+}
+
+// Bucket hari: rollup hari jika tidak ada jam dirty di hari itu, selain itu dari bucket jam
+func rollupDayParts(start, end string) string {
+	return fmt.Sprintf(`
+		SELECT r.bucket, r.min_value, r.max_value, r.sum_value, r.sample_count, r.min_id
+		FROM sensor_rollup_1d r
+		WHERE r.device_unique_id = $1 AND r.parameter_name = $2 AND %s
+		  AND NOT EXISTS (
+			SELECT 1 FROM sensor_rollup_dirty d
+			WHERE d.device_unique_id = $1 AND d.parameter_name = $2
+			  AND d.bucket >= r.bucket AND d.bucket < r.bucket + INTERVAL '1 day'
+		  )
+		UNION ALL
+		SELECT DATE_TRUNC('day', h.bucket), MIN(h.min_value), MAX(h.max_value), SUM(h.sum_value),
+		       SUM(h.sample_count)::bigint, MIN(h.min_id)
+		FROM (%s) h
+		WHERE DATE_TRUNC('day', h.bucket) IN (
+			SELECT DATE_TRUNC('day', d.bucket) FROM sensor_rollup_dirty d
+			WHERE d.device_unique_id = $1 AND d.parameter_name = $2 AND %s
+		)
+		GROUP BY DATE_TRUNC('day', h.bucket)`,
+		rollupWindow("r.bucket", start, end), rollupHourParts(start, end), rollupWindow("d.bucket", start, end))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+)
+
+// Tabel tambahan di luar sensor_logs, dibuat saat startup jika belum ada
+var schemaStatements = []string{
+	apiKeysSchema,
+	apiKeysUsageSchema,
+	sensorNotifySchema,
+	alertsSchema,
+	deviceStatusSchema,
+	devicesSchema,
+	parameterStatsSchema,
+	rollupSchema,
+	sensorTriggerSeedsSchema,
+}
+
+// Buat tabel/index yang dibutuhkan fitur
+func ensureSchema() {
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatal("Failed to prepare schema:", err)
+		}
+	}
+	for _, seed := range []func() error{seedParameterStats, seedRollups} {
+		if err := seed(); err != nil {
+			log.Fatal("Failed to prepare schema:", err)
+		}
+	}
+}
+
+// Progres pengisian awal tiap trigger sensor_logs, agar bisa dilanjutkan setelah restart
+const sensorTriggerSeedsSchema = `
+CREATE TABLE IF NOT EXISTS sensor_trigger_seeds (
+	name     TEXT PRIMARY KEY,
+	boundary BIGINT NOT NULL,
+	done_id  BIGINT NOT NULL DEFAULT 0
+);
+`
+
+// Jumlah id sensor_logs per batch pengisian awal
+const sensorSeedBatch = 50000
+
+// Trigger di sensor_logs beserta pengisian awal dari data lama
+type sensorTrigger struct {
+	name     string   // nama trigger, juga kunci di sensor_trigger_seeds
+	setup    []string // dijalankan tepat sebelum trigger dibuat (mis. TRUNCATE)
+	create   string   // CREATE TRIGGER
+	backfill string   // isi dari sensor_logs WHERE id > $1 AND id <= $2
+}
+
+// Pasang trigger di sensor_logs sekali saja, lalu isi data lama per batch.
+// sensor_logs hanya dikunci sebentar untuk memasang trigger dan mencatat MAX(id):
+// baris sesudahnya ditangani trigger, baris sampai batas itu diisi batch demi batch
+// tanpa mengunci INSERT. Progres disimpan sehingga pengisian berlanjut setelah restart.
+func installSensorTrigger(t sensorTrigger) error {
+	var installed bool
+	if err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = $1 AND tgrelid = 'sensor_logs'::regclass)
+	`, t.name).Scan(&installed); err != nil {
+		return err
+	}
+	if !installed {
+		if err := createSensorTrigger(t); err != nil {
+			return err
+		}
+	}
+
+	// Trigger lama tanpa catatan progres dianggap sudah terisi
+	var boundary, done int64
+	err := db.QueryRow(`SELECT boundary, done_id FROM sensor_trigger_seeds WHERE name = $1`, t.name).Scan(&boundary, &done)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if done >= boundary {
+		return nil
+	}
+
+	log.Printf("⏳ Mengisi data awal %s dari sensor_logs (id %d-%d)...", t.name, done+1, boundary)
+	for done < boundary {
+		next := min(done+sensorSeedBatch, boundary)
+		if err := seedSensorBatch(t, done, next); err != nil {
+			return err
+		}
+		done = next
+	}
+	log.Printf("✅ %s siap", t.name)
+	return nil
+}
+
+// Pasang trigger dan catat batas id yang harus diisi dari data lama
+func createSensorTrigger(t sensorTrigger) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Tunggu INSERT yang sedang berjalan selesai agar MAX(id) menjadi batas yang tepat
+	if _, err := tx.Exec(`LOCK TABLE sensor_logs IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	for _, stmt := range t.setup {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(t.create); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO sensor_trigger_seeds (name, boundary)
+		SELECT $1, COALESCE(MAX(id), 0) FROM sensor_logs
+		ON CONFLICT (name) DO UPDATE SET boundary = EXCLUDED.boundary, done_id = 0
+	`, t.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Isi satu rentang id beserta progresnya dalam satu transaksi
+func seedSensorBatch(t sensorTrigger, from, to int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(t.backfill, from, to); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE sensor_trigger_seeds SET done_id = $2 WHERE name = $1`, t.name, to); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Satu baris per bucket dengan beberapa statistik sekaligus
+type SensorStats struct {
+	DeviceUniqueID string   `json:"device_unique_id"`
+	ParameterName  string   `json:"parameter_name"`
+	RecordedAt     string   `json:"recorded_at"`
+	Min            *float64 `json:"min,omitempty"`
+	Max            *float64 `json:"max,omitempty"`
+	Avg            *float64 `json:"avg,omitempty"`
+	Count          *int64   `json:"count,omitempty"`
+	Stddev         *float64 `json:"stddev,omitempty"`
+	Sum            *float64 `json:"sum,omitempty"`
+	First          *float64 `json:"first,omitempty"`
+	Last           *float64 `json:"last,omitempty"`
+	Median         *float64 `json:"median,omitempty"`
+	// Persentil lain, mis. {"p95": 31.2}
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// Ekspresi SQL per statistik
+var statExprs = map[string]string{
+	"min":    "MIN(value)",
+	"max":    "MAX(value)",
+	"avg":    "AVG(value)",
+	"count":  "COUNT(*)",
+	"stddev": "STDDEV_SAMP(value)",
+	"sum":    "SUM(value)",
+	"first":  "(ARRAY_AGG(value ORDER BY recorded_at ASC))[1]",
+	"last":   "(ARRAY_AGG(value ORDER BY recorded_at DESC))[1]",
+}
+
+// Ekspresi SQL statistik, termasuk median dan pNN
+func statExpr(name string) (string, bool) {
+	if expr, ok := statExprs[name]; ok {
+		return expr, true
+	}
+	if _, ok := parsePercentile(name); ok {
+		return valueAggFunc(name)
+	}
+	return "", false
+}
+
+// Nama lama high/low tetap diterima
+var statAliases = map[string]string{
+	"high": "max",
+	"low":  "min",
+}
+
+// Value mode multi statistik: lebih dari satu nilai atau nama statistik baru.
+// high/low/avg tunggal tetap memakai format SensorData lama.
+func isStatsValueMode(valueMode string) bool {
+	if strings.Contains(valueMode, ",") {
+		return true
+	}
+	if _, ok := valueAggFunc(valueMode); ok {
+		return false
+	}
+	_, ok := statExpr(valueMode)
+	return ok
+}
+
+// Parse value=min,avg,max,... menjadi daftar statistik unik
+func parseStatList(valueMode string) ([]string, error) {
+	var stats []string
+	seen := map[string]bool{}
+	for _, v := range strings.Split(valueMode, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if alias, ok := statAliases[v]; ok {
+			v = alias
+		}
+		if _, ok := statExpr(v); !ok {
+			return nil, fmt.Errorf("value tidak dikenal: %s (min | avg | max | count | stddev | sum | first | last | median | pNN)", v)
+		}
+		if !seen[v] {
+			seen[v] = true
+			stats = append(stats, v)
+		}
+	}
+	return stats, nil
+}
+
+// Isi field SensorStats sesuai nama statistik
+func setStat(s *SensorStats, name string, v sql.NullFloat64) {
+	if !v.Valid {
+		return
+	}
+	val := v.Float64
+	switch name {
+	case "min":
+		s.Min = &val
+	case "max":
+		s.Max = &val
+	case "avg":
+		s.Avg = &val
+	case "count":
+		c := int64(val)
+		s.Count = &c
+	case "stddev":
+		s.Stddev = &val
+	case "sum":
+		s.Sum = &val
+	case "first":
+		s.First = &val
+	case "last":
+		s.Last = &val
+	case "median":
+		s.Median = &val
+	default:
+		if s.Percentiles == nil {
+			s.Percentiles = map[string]float64{}
+		}
+		s.Percentiles[name] = val
+	}
+}
+
+// Handler: Ringkas dengan beberapa statistik per bucket
+func handleStatsMode(w http.ResponseWriter, deviceID, jenis, periode, mode, valueMode, tahun, bulan, tanggal, fromStr, toStr, pgInterval string, limit int, zona Zona) {
+	stats, err := parseStatList(valueMode)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if jenis == "" {
+		respondError(w, "parameter jenis diperlukan", http.StatusBadRequest)
+		return
+	}
+
+	// Tentukan window waktu
+	loc := zona.Loc
+	var from, to time.Time
+	defaultUnit := "hour"
+	filter := periode
+	if fromStr != "" || toStr != "" {
+		from, to, err = resolveTimeRange(fromStr, toStr, loc, maxAggregateRange)
+		if to.Sub(from) > 48*time.Hour {
+			defaultUnit = "day"
+		}
+		filter = "range"
+	} else {
+		from, to, defaultUnit, err = resolvePeriodeWindow(periode, tahun, bulan, tanggal, loc)
+		if tanggal != "" {
+			filter = "tanggal"
+		}
+	}
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groupExpr, labelExpr := bucketColumns(pgInterval, defaultUnit, zona.Column)
+
+	cols := make([]string, len(stats))
+	for i, name := range stats {
+		expr, _ := statExpr(name)
+		cols[i] = fmt.Sprintf("ROUND((%s)::numeric, 2)::float8 AS %s", expr, name)
+	}
+
+	args := []interface{}{deviceID, pq.Array(strings.Split(jenis, ",")), from.In(lokasiWIB), to.In(lokasiWIB)}
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = "LIMIT $5"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT device_unique_id, parameter_name,
+		       %s AS recorded_at,
+		       %s
+		FROM sensor_logs
+		WHERE device_unique_id = $1
+		  AND parameter_name = ANY($2)
+		  AND recorded_at >= $3
+		  AND recorded_at <  $4
+		GROUP BY device_unique_id, parameter_name, %s
+		ORDER BY %s DESC, parameter_name ASC
+		%s
+	`, labelExpr, strings.Join(cols, ",\n\t\t       "), groupExpr, groupExpr, limitClause)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	data := []SensorStats{}
+	for rows.Next() {
+		var s SensorStats
+		values := make([]sql.NullFloat64, len(stats))
+		dest := []interface{}{&s.DeviceUniqueID, &s.ParameterName, &s.RecordedAt}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			continue
+		}
+		for i, name := range stats {
+			setStat(&s, name, values[i])
+		}
+		data = append(data, s)
+	}
+
+	// Balik urutan data untuk grafik
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+
+	respond(w, Response{
+		Status:    true,
+		Filter:    filter,
+		Mode:      mode,
+		Timezone:  zona.Label,
+		Catalog:   deviceCatalog(deviceID),
+		DeviceID:  deviceID,
+		TimeRange: formatTimeRange(from.In(loc), to.In(loc)),
+		Value:     strings.Join(stats, ","),
+		Total:     len(data),
+		Data:      data,
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	streamHeartbeat    = 15 * time.Second
+	streamBackfillPage = 1000
+	streamMaxBackfill  = 10000
+)
+
+// Tulis satu event SSE
+func writeSSE(w http.ResponseWriter, id int, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// Handler: GET /api/stream?device_id=a,b&jenis=x,y (Server-Sent Events)
+// id event adalah posisi resume, bukan selalu id baris: baris yang terlambat commit bisa
+// ber-id lebih kecil, sehingga resume dengan Last-Event-ID bisa mengirim ulang beberapa baris
+// (bedakan dengan data.id). Backlog lebih dari streamMaxBackfill baris diakhiri event
+// "truncated" lalu stream ditutup; client menyambung ulang untuk melanjutkan.
+func streamSensorData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method harus GET", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, "streaming tidak didukung", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("device_id") == "" {
+		respondError(w, "device_id wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	// Device yang tidak boleh diakses token disaring diam-diam
+	devices := identityFromContext(r.Context()).FilterDevices(splitList(q.Get("device_id")))
+	if len(devices) == 0 {
+		respondError(w, "Token tidak punya akses ke device ini", http.StatusForbidden)
+		return
+	}
+	params := splitList(q.Get("jenis"))
+
+	zona, err := resolveZona(q.Get("zonawaktu"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Resume dari Last-Event-ID (header dari EventSource atau query)
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = q.Get("last_event_id")
+	}
+	afterID := 0
+	if lastID != "" {
+		if afterID, err = strconv.Atoi(lastID); err != nil || afterID < 0 {
+			respondError(w, "Last-Event-ID tidak valid", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Daftar ke hub dulu agar tidak ada baris yang terlewat selama backfill
+	sub := newLiveSub(devices, params)
+	liveHub.subscribe(sub)
+	defer liveHub.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	writeSSE(w, 0, "ready", Response{
+		Status:   true,
+		Filter:   "stream",
+		Mode:     "live",
+		Timezone: zona.Label,
+		DeviceID: strings.Join(devices, ","),
+	})
+	flusher.Flush()
+
+	// Id yang terkirim lewat backlog; hub bisa mengirim baris yang sama (terlambat commit)
+	backfilled := map[int]bool{}
+	if afterID > 0 {
+		// Di atas posisi aman hub, baris yang belum commit masih bisa menyusul lewat live
+		safe := liveHub.resumeID()
+		for next, sent := afterID, 0; ; {
+			if sent >= streamMaxBackfill {
+				// Resume harus maju dari afterID agar client tidak mengulang backlog yang sama
+				resume := min(next, safe)
+				if resume <= afterID {
+					resume = next
+				}
+				writeSSE(w, resume, "truncated", Response{
+					Status:  false,
+					Message: fmt.Sprintf("Backlog lebih dari %d baris, sambung ulang dengan Last-Event-ID untuk melanjutkan", streamMaxBackfill),
+				})
+				flusher.Flush()
+				return
+			}
+			limit := min(streamBackfillPage, streamMaxBackfill-sent)
+			page, err := fetchReadingsSince(devices, params, next, limit)
+			if err != nil {
+				writeSSE(w, 0, "error", Response{Status: false, Message: err.Error()})
+				return
+			}
+			for _, lr := range page {
+				if writeSSE(w, min(lr.ID, safe), "reading", lr.SensorData(zona)) != nil {
+					return
+				}
+				backfilled[lr.ID] = true
+				next = lr.ID
+			}
+			flusher.Flush()
+			sent += len(page)
+			if len(page) < limit {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case lr, ok := <-sub.ch:
+			if !ok {
+				// Terlalu lambat, client reconnect dengan Last-Event-ID
+				return
+			}
+			if backfilled[lr.ID] {
+				delete(backfilled, lr.ID)
+				continue
+			}
+			if writeSSE(w, lr.Cursor, "reading", lr.SensorData(zona)) != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
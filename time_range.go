@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Batas maksimal rentang from/to
+const (
+	maxRawRange       = 31 * 24 * time.Hour
+	maxAggregateRange = 366 * 24 * time.Hour
+)
+
+// Parse waktu ISO 8601. Tanpa offset dianggap dalam zona waktu yang diminta.
+func parseTimeParam(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("format waktu tidak valid: %s (gunakan ISO 8601)", s)
+}
+
+// Resolve from/to menjadi window [from, to). to kosong berarti sekarang.
+func resolveTimeRange(fromStr, toStr string, loc *time.Location, maxRange time.Duration) (time.Time, time.Time, error) {
+	if fromStr == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("parameter from wajib diisi")
+	}
+	from, err := parseTimeParam(fromStr, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to := time.Now().In(loc)
+	if toStr != "" {
+		if to, err = parseTimeParam(toStr, loc); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from harus lebih awal dari to")
+	}
+	if to.Sub(from) > maxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("rentang waktu maksimal %d hari", int(maxRange.Hours()/24))
+	}
+	return from.In(loc), to.In(loc), nil
+}
+
+// Window waktu (di zona loc) untuk periode hari/minggu_ini/bulan/tanggal,
+// beserta bucket default ringkas (hour/day)
+func resolvePeriodeWindow(periode, tahun, bulan, tanggal string, loc *time.Location) (time.Time, time.Time, string, error) {
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	if tanggal != "" {
+		day, err := time.ParseInLocation("2006-01-02", tanggal, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("format tanggal harus YYYY-MM-DD")
+		}
+		return day, day.AddDate(0, 0, 1), "hour", nil
+	}
+
+	switch periode {
+	case "hari":
+		return now.Add(-24 * time.Hour), now, "hour", nil
+	case "minggu_ini":
+		return today.AddDate(0, 0, -6), now, "day", nil
+	case "bulan":
+		if bulan == "" {
+			return today.AddDate(0, 0, -29), now, "day", nil
+		}
+		month, year := parseMonth(bulan)
+		if tahun != "" && !strings.Contains(bulan, "-") {
+			year = tahun
+		}
+		y, errY := strconv.Atoi(year)
+		m, errM := strconv.Atoi(month)
+		if errY != nil || errM != nil || m < 1 || m > 12 {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("format bulan tidak valid")
+		}
+		start := time.Date(y, time.Month(m), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0), "day", nil
+	default:
+		return time.Time{}, time.Time{}, "", fmt.Errorf("periode tidak valid untuk value mode")
+	}
+}
+
+// Format window untuk Response.TimeRange (interval ISO 8601)
+func formatTimeRange(from, to time.Time) string {
+	return from.Format(time.RFC3339) + "/" + to.Format(time.RFC3339)
+}
+
+// Handler: Rentang waktu from/to (raw, ringkas, value high/low/avg)
+func handleTimeRange(w http.ResponseWriter, deviceID, jenis, mode, valueMode, fromStr, toStr, pgInterval string, limit int, page pageRequest, zona Zona) {
+	aggregate := mode == "ringkas" || valueMode != ""
+	maxRange := maxRawRange
+	if aggregate {
+		maxRange = maxAggregateRange
+	}
+
+	loc := zona.Loc
+	from, to, err := resolveTimeRange(fromStr, toStr, loc, maxRange)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parameter query: data di database dalam WIB
+	args := []interface{}{deviceID, from.In(lokasiWIB), to.In(lokasiWIB)}
+	paramFilter := ""
+	if jenis != "" {
+		args = append(args, pq.Array(strings.Split(jenis, ",")))
+		paramFilter = fmt.Sprintf("AND parameter_name = ANY($%d)", len(args))
+	} else if aggregate {
+		respondError(w, "parameter jenis diperlukan", http.StatusBadRequest)
+		return
+	}
+	var query string
+	if aggregate {
+		limitClause := ""
+		if limit > 0 {
+			args = append(args, limit)
+			limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+		}
+
+		aggFunc := "AVG(value)"
+		if valueMode != "" {
+			var ok bool
+			if aggFunc, ok = valueAggFunc(valueMode); !ok {
+				respondError(w, "value hanya high | low | avg | median | pNN", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Tanpa interval: rentang pendek per jam, selebihnya per hari
+		bucket := fmt.Sprintf("DATE_TRUNC('hour', %s)", zona.Column)
+		if pgInterval != "" {
+			bucket, _ = bucketColumns(pgInterval, "", zona.Column)
+		} else if to.Sub(from) > 48*time.Hour {
+			bucket = fmt.Sprintf("DATE_TRUNC('day', %s)", zona.Column)
+		}
+
+		query = fmt.Sprintf(`
+			SELECT MIN(id) AS id, device_unique_id, parameter_name,
+			       ROUND((%s)::numeric, 2) AS value,
+			       TO_CHAR(%s, 'YYYY-MM-DD HH24:MI:SS') AS recorded_at
+			FROM sensor_logs
+			WHERE device_unique_id = $1
+			  AND recorded_at >= $2
+			  AND recorded_at <  $3
+			  %s
+			GROUP BY device_unique_id, parameter_name, %s
+			ORDER BY %s DESC, parameter_name ASC
+			%s
+		`, aggFunc, bucket, paramFilter, bucket, bucket, limitClause)
+	} else {
+		keyset, orderLimit := page.clauses(&args)
+		query = fmt.Sprintf(`
+			SELECT id, device_unique_id, parameter_name, value,
+			       TO_CHAR(%s, 'YYYY-MM-DD HH24:MI:SS') AS recorded_at, %s
+			FROM sensor_logs
+			WHERE device_unique_id = $1
+			  AND recorded_at >= $2
+			  AND recorded_at <  $3
+			  %s
+			  %s
+			%s
+		`, zona.Column, pageKeyColumn, paramFilter, keyset, orderLimit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	resp := Response{
+		Status:    true,
+		Filter:    "range",
+		Mode:      mode,
+		Timezone:  zona.Label,
+		Catalog:   deviceCatalog(deviceID),
+		DeviceID:  deviceID,
+		TimeRange: formatTimeRange(from, to),
+		Value:     valueMode,
+	}
+	if !aggregate {
+		page.respond(w, rows, resp)
+		return
+	}
+
+	data := scanSensorRows(rows)
+	// Balik urutan data ringkas agar dari lama ke baru
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+	resp.Total, resp.Data = len(data), data
+	respond(w, resp)
+}
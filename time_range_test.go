@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeParam(t *testing.T) {
+	wita := time.FixedZone("WITA", 8*3600)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2026-01-02T03:04:05Z", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2026-01-02T03:04:05+07:00", time.Date(2026, 1, 1, 20, 4, 5, 0, time.UTC)},
+		{"2026-01-02T03:04:05", time.Date(2026, 1, 2, 3, 4, 5, 0, wita)},
+		{"2026-01-02T03:04", time.Date(2026, 1, 2, 3, 4, 0, 0, wita)},
+		{"2026-01-02 03:04:05", time.Date(2026, 1, 2, 3, 4, 5, 0, wita)},
+		{"2026-01-02", time.Date(2026, 1, 2, 0, 0, 0, 0, wita)},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeParam(tt.in, wita)
+		if err != nil {
+			t.Errorf("parseTimeParam(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTimeParam(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := parseTimeParam("02/01/2026", wita); err == nil {
+		t.Error("parseTimeParam: format tidak valid harus error")
+	}
+}
+
+func TestResolveTimeRange(t *testing.T) {
+	loc := time.FixedZone("WIB", 7*3600)
+	day := 24 * time.Hour
+	tests := []struct {
+		name     string
+		from, to string
+		maxRange time.Duration
+		wantErr  bool
+		wantSpan time.Duration
+	}{
+		{"rentang valid", "2026-01-01", "2026-01-08", 31 * day, false, 7 * day},
+		{"tepat batas", "2026-01-01", "2026-02-01", 31 * day, false, 31 * day},
+		{"melebihi batas", "2026-01-01", "2026-02-02", 31 * day, true, 0},
+		{"from wajib", "", "2026-01-08", 31 * day, true, 0},
+		{"from sama dengan to", "2026-01-01", "2026-01-01", 31 * day, true, 0},
+		{"from setelah to", "2026-01-08", "2026-01-01", 31 * day, true, 0},
+		{"format salah", "kemarin", "", 31 * day, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := resolveTimeRange(tt.from, tt.to, loc, tt.maxRange)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := to.Sub(from); got != tt.wantSpan {
+				t.Errorf("span = %v, want %v", got, tt.wantSpan)
+			}
+			if from.Location() != loc || to.Location() != loc {
+				t.Errorf("hasil harus di zona %v", loc)
+			}
+		})
+	}
+}
+
+func TestResolveTimeRangeDefaultsToNow(t *testing.T) {
+	loc := time.UTC
+	before := time.Now()
+	from, to, err := resolveTimeRange(before.Add(-time.Hour).Format(time.RFC3339), "", loc, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to.Before(before.Truncate(time.Second)) || to.After(time.Now()) {
+		t.Errorf("to kosong harus sekarang, dapat %v", to)
+	}
+	if !from.Before(to) {
+		t.Errorf("from %v harus sebelum to %v", from, to)
+	}
+}
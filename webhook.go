@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookQueueSize   = 1000
+	webhookMaxAttempts = 5
+	webhookWorkers     = 4
+	webhookTimeout     = 5 * time.Second
+)
+
+// Jeda retry pertama, berlipat tiap percobaan (var agar bisa dipercepat di test)
+var webhookRetryBase = 5 * time.Second
+
+// Satu pengiriman webhook ke satu URL
+type webhookJob struct {
+	url     string
+	event   string
+	body    []byte
+	attempt int
+	public  bool // URL dari user (rule alert): hanya boleh ke alamat publik
+}
+
+var (
+	webhookQueue  = make(chan webhookJob, webhookQueueSize)
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+
+	// Client untuk URL dari user: alamat tujuan dicek saat dial, termasuk setelah redirect
+	// dan DNS yang berubah setelah validasi
+	publicWebhookClient = &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: webhookTimeout,
+				Control: func(network, address string, _ syscall.RawConn) error {
+					host, _, err := net.SplitHostPort(address)
+					if err != nil {
+						return err
+					}
+					if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+						return fmt.Errorf("alamat webhook %s tidak diizinkan", host)
+					}
+					return nil
+				},
+			}).DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+	}
+)
+
+// Antrikan event ke semua URL dari config. Payload ditandatangani HMAC-SHA256 dengan config.WebhookSecret.
+func enqueueWebhook(urls []string, event string, payload interface{}) {
+	enqueueWebhookJobs(urls, event, payload, false)
+}
+
+// Seperti enqueueWebhook, untuk URL yang diisi user lewat API (hanya alamat publik)
+func enqueuePublicWebhook(urls []string, event string, payload interface{}) {
+	enqueueWebhookJobs(urls, event, payload, true)
+}
+
+func enqueueWebhookJobs(urls []string, event string, payload interface{}, public bool) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("webhook marshal:", err)
+		return
+	}
+	for _, u := range urls {
+		queueWebhookJob(webhookJob{url: u, event: event, body: body, public: public})
+	}
+}
+
+// URL webhook harus http(s) absolut
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL webhook tidak valid: %s", raw)
+	}
+	return nil
+}
+
+// URL webhook dari user: selain valid, host harus resolve ke alamat publik
+// (bukan loopback, link-local, jaringan privat, dsb.)
+func validatePublicWebhookURL(raw string) error {
+	if err := validateWebhookURL(raw); err != nil {
+		return err
+	}
+	u, _ := url.Parse(raw)
+	host := u.Hostname()
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("host webhook tidak bisa di-resolve: %s", host)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("URL webhook harus ke alamat publik: %s (%s)", raw, addr.IP)
+		}
+	}
+	return nil
+}
+
+// Shared address space (RFC 6598), tidak tercakup net.IP.IsPrivate
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Alamat yang boleh dituju webhook dari user
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || carrierGradeNAT.Contains(ip))
+}
+
+func queueWebhookJob(job webhookJob) {
+	select {
+	case webhookQueue <- job:
+	default:
+		log.Printf("webhook %s ke %s dibuang: antrian penuh", job.event, job.url)
+	}
+}
+
+// Jalankan beberapa worker agar satu URL lambat tidak menahan antrian
+func startWebhookWorkers() {
+	for i := 0; i < webhookWorkers; i++ {
+		go webhookWorker()
+	}
+}
+
+func webhookWorker() {
+	for job := range webhookQueue {
+		deliverWebhook(job)
+	}
+}
+
+// Kirim webhook, ulangi dengan backoff eksponensial jika gagal
+func deliverWebhook(job webhookJob) {
+	err := sendWebhook(job)
+	if err == nil {
+		return
+	}
+	job.attempt++
+	if job.attempt >= webhookMaxAttempts {
+		log.Printf("webhook %s ke %s gagal setelah %d percobaan: %v", job.event, job.url, job.attempt, err)
+		return
+	}
+	retry := job
+	time.AfterFunc(webhookRetryBase<<(job.attempt-1), func() { queueWebhookJob(retry) })
+}
+
+// Tanda tangan: hex(HMAC-SHA256(secret, timestamp + "." + body))
+func signWebhook(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(config.WebhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sendWebhook(job webhookJob) error {
+	req, err := http.NewRequest(http.MethodPost, job.url, bytes.NewReader(job.body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Temins-Event", job.event)
+	req.Header.Set("X-Temins-Timestamp", timestamp)
+	req.Header.Set("X-Temins-Signature", "sha256="+signWebhook(timestamp, job.body))
+
+	client := webhookClient
+	if job.public {
+		client = publicWebhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
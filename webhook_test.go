@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendWebhookSignature(t *testing.T) {
+	saved := config.WebhookSecret
+	defer func() { config.WebhookSecret = saved }()
+	config.WebhookSecret = "rahasia"
+
+	type received struct {
+		event, timestamp, signature string
+		body                        []byte
+	}
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Get("X-Temins-Event"), r.Header.Get("X-Temins-Timestamp"), r.Header.Get("X-Temins-Signature"), body}
+	}))
+	defer srv.Close()
+
+	body := []byte(`{"event":"firing"}`)
+	if err := sendWebhook(webhookJob{url: srv.URL, event: "alert.firing", body: body}); err != nil {
+		t.Fatal(err)
+	}
+	r := <-got
+	if r.event != "alert.firing" || string(r.body) != string(body) {
+		t.Errorf("event/body = %s %s", r.event, r.body)
+	}
+
+	// Penerima memverifikasi HMAC-SHA256(secret, timestamp + "." + body)
+	mac := hmac.New(sha256.New, []byte("rahasia"))
+	mac.Write([]byte(r.timestamp + "." + string(r.body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.signature != want {
+		t.Errorf("signature = %s, want %s", r.signature, want)
+	}
+}
+
+func TestSendWebhookStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	if err := sendWebhook(webhookJob{url: srv.URL, event: "test"}); err == nil {
+		t.Error("status non-2xx harus error")
+	}
+}
+
+var startTestWebhookWorkers sync.Once
+
+func TestWebhookRetryBackoff(t *testing.T) {
+	savedBase := webhookRetryBase
+	defer func() { webhookRetryBase = savedBase }()
+	webhookRetryBase = 20 * time.Millisecond
+	startTestWebhookWorkers.Do(startWebhookWorkers)
+
+	tests := []struct {
+		name      string
+		failFirst int
+		want      int
+	}{
+		{"berhasil setelah retry", 2, 3},
+		{"berhenti di batas percobaan", 100, webhookMaxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var attempts []time.Time
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				attempts = append(attempts, time.Now())
+				n := len(attempts)
+				mu.Unlock()
+				if n <= tt.failFirst {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer srv.Close()
+
+			enqueueWebhook([]string{srv.URL}, "test", map[string]string{"a": "b"})
+
+			// Total jeda maksimal 20+40+80+160ms
+			time.Sleep(600 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if len(attempts) != tt.want {
+				t.Fatalf("percobaan = %d, want %d", len(attempts), tt.want)
+			}
+			// Jeda antar percobaan berlipat: base, 2x base, 4x base, ...
+			for i := 1; i < len(attempts); i++ {
+				if gap, want := attempts[i].Sub(attempts[i-1]), webhookRetryBase<<(i-1); gap < want {
+					t.Errorf("jeda percobaan %d = %v, minimal %v", i+1, gap, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePublicWebhookURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://93.184.216.34/hook", false},
+		{"http://127.0.0.1:8080/hook", true},
+		{"http://localhost/hook", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://[::1]/hook", true},
+		{"http://10.0.0.5/hook", true},
+		{"ftp://93.184.216.34/hook", true},
+		{"/relatif", true},
+	}
+	for _, tt := range tests {
+		if err := validatePublicWebhookURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("validatePublicWebhookURL(%s) = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPublicWebhookBlocksPrivateDial(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hit = true }))
+	defer srv.Close()
+
+	// URL lolos validasi lalu resolve ke loopback (mis. DNS rebinding) tetap ditolak saat dial
+	if err := sendWebhook(webhookJob{url: srv.URL, event: "test", public: true}); err == nil || hit {
+		t.Errorf("webhook publik ke loopback harus ditolak, err = %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	wsMaxPairs        = 500
+	wsDefaultBackfill = 100
+	wsMaxBackfill     = 5000
+	wsMaxMessage      = 64 << 10
+)
+
+// Pasangan device/parameter; jenis kosong atau "*" = semua parameter device
+type wsPair struct {
+	DeviceID string `json:"device_id"`
+	Jenis    string `json:"jenis"`
+}
+
+// Pesan dari client:
+//
+//	{"action":"subscribe","pairs":[{"device_id":"a","jenis":"suhu"}]}
+//	{"action":"unsubscribe","pairs":[{"device_id":"a"}]}
+//	{"action":"backfill","pairs":[...],"limit":100}  (pairs kosong = semua langganan)
+//	{"action":"ping"}
+type wsRequest struct {
+	Action string   `json:"action"`
+	Pairs  []wsPair `json:"pairs"`
+	Limit  int      `json:"limit"`
+}
+
+// Pesan ke client; Data berisi SensorData (reading) atau []SensorData (backfill)
+type wsMessage struct {
+	Type          string              `json:"type"`
+	Data          interface{}         `json:"data,omitempty"`
+	Subscriptions map[string][]string `json:"subscriptions,omitempty"`
+	Timezone      string              `json:"timezone,omitempty"`
+	Time          string              `json:"time,omitempty"`
+	Message       string              `json:"message,omitempty"`
+}
+
+// Request handshake WebSocket (Upgrade: websocket)
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// Tolak handshake dari origin browser yang tidak diizinkan CORS
+func checkWebSocketOrigin(cfg *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin != "" && allowedOrigin(origin) == "" {
+		return fmt.Errorf("origin tidak diizinkan: %s", origin)
+	}
+	return nil
+}
+
+// Handler: GET /api/ws?zonawaktu=wib (WebSocket)
+func websocketSensorData(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketUpgrade(r) {
+		respondError(w, "endpoint ini membutuhkan koneksi WebSocket", http.StatusBadRequest)
+		return
+	}
+	zona, err := resolveZona(r.URL.Query().Get("zonawaktu"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: checkWebSocketOrigin,
+		Handler: func(ws *websocket.Conn) {
+			serveWebSocket(ws, identityFromContext(r.Context()), zona)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func serveWebSocket(ws *websocket.Conn, identity *Identity, zona Zona) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = wsMaxMessage
+
+	sub := newLiveSub(nil, nil)
+	liveHub.subscribe(sub)
+	defer liveHub.unsubscribe(sub)
+
+	// Pembaca terpisah; semua penulisan ke koneksi hanya dari loop di bawah
+	requests := make(chan wsRequest)
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(done)
+		for {
+			var req wsRequest
+			err := websocket.JSON.Receive(ws, &req)
+			switch err.(type) {
+			case nil:
+			case *json.SyntaxError, *json.UnmarshalTypeError:
+				// Pesan rusak dibalas error, koneksi tetap hidup
+				req = wsRequest{Action: "invalid"}
+			default:
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	send := func(msg wsMessage) bool {
+		return websocket.JSON.Send(ws, msg) == nil
+	}
+
+	if !send(wsMessage{Type: "ready", Timezone: zona.Label}) {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-heartbeat.C:
+			if !send(wsMessage{Type: "heartbeat", Time: now.In(zona.Loc).Format(time.RFC3339)}) {
+				return
+			}
+		case lr, ok := <-sub.ch:
+			if !ok {
+				send(wsMessage{Type: "error", Message: "client terlalu lambat, koneksi diputus"})
+				return
+			}
+			if !send(wsMessage{Type: "reading", Data: lr.SensorData(zona)}) {
+				return
+			}
+		case req := <-requests:
+			if !send(handleWebSocketRequest(sub, identity, zona, req)) {
+				return
+			}
+		}
+	}
+}
+
+// Proses satu pesan client dan kembalikan balasannya
+func handleWebSocketRequest(sub *liveSub, identity *Identity, zona Zona, req wsRequest) wsMessage {
+	switch req.Action {
+	case "ping":
+		return wsMessage{Type: "pong", Time: time.Now().In(zona.Loc).Format(time.RFC3339)}
+
+	case "subscribe":
+		if len(req.Pairs) == 0 {
+			return wsMessage{Type: "error", Message: "pairs wajib diisi"}
+		}
+		var denied []string
+		for _, p := range req.Pairs {
+			if p.DeviceID == "" {
+				return wsMessage{Type: "error", Message: "device_id wajib diisi di setiap pair"}
+			}
+			if !identity.CanAccessDevice(p.DeviceID) {
+				denied = append(denied, p.DeviceID)
+			}
+		}
+		if len(denied) > 0 {
+			return wsMessage{Type: "error", Message: "Token tidak punya akses ke device: " + strings.Join(denied, ",")}
+		}
+		if countPairs(sub.list())+len(req.Pairs) > wsMaxPairs {
+			return wsMessage{Type: "error", Message: fmt.Sprintf("maksimal %d langganan per koneksi", wsMaxPairs)}
+		}
+		for _, p := range req.Pairs {
+			sub.add(p.DeviceID, pairParam(p))
+		}
+		return wsMessage{Type: "subscribed", Subscriptions: sub.list()}
+
+	case "unsubscribe":
+		if len(req.Pairs) == 0 {
+			return wsMessage{Type: "error", Message: "pairs wajib diisi"}
+		}
+		for _, p := range req.Pairs {
+			sub.remove(p.DeviceID, pairParam(p))
+		}
+		return wsMessage{Type: "unsubscribed", Subscriptions: sub.list()}
+
+	case "backfill":
+		limit := req.Limit
+		if limit <= 0 {
+			limit = wsDefaultBackfill
+		}
+		if limit > wsMaxBackfill {
+			return wsMessage{Type: "error", Message: fmt.Sprintf("limit maksimal %d", wsMaxBackfill)}
+		}
+
+		pairs := sub.list()
+		if len(req.Pairs) > 0 {
+			pairs = map[string][]string{}
+			for _, p := range req.Pairs {
+				if !identity.CanAccessDevice(p.DeviceID) {
+					return wsMessage{Type: "error", Message: "Token tidak punya akses ke device: " + p.DeviceID}
+				}
+				pairs[p.DeviceID] = append(pairs[p.DeviceID], pairParam(p))
+			}
+		}
+		if len(pairs) == 0 {
+			return wsMessage{Type: "error", Message: "belum ada langganan untuk di-backfill"}
+		}
+
+		readings, err := fetchLatestReadings(pairs, limit)
+		if err != nil {
+			return wsMessage{Type: "error", Message: err.Error()}
+		}
+		data := make([]SensorData, 0, len(readings))
+		for _, lr := range readings {
+			data = append(data, lr.SensorData(zona))
+		}
+		return wsMessage{Type: "backfill", Data: data}
+
+	default:
+		return wsMessage{Type: "error", Message: "action harus subscribe, unsubscribe, backfill atau ping"}
+	}
+}
+
+func pairParam(p wsPair) string {
+	if p.Jenis == "" {
+		return allParams
+	}
+	return p.Jenis
+}
+
+func countPairs(pairs map[string][]string) int {
+	n := 0
+	for _, params := range pairs {
+		n += len(params)
+	}
+	return n
+}
+
+// N baris terakhir untuk pasangan device/parameter (urut id naik)
+func fetchLatestReadings(pairs map[string][]string, limit int) ([]liveReading, error) {
+	var allDevices, pairDevices, pairParams []string
+	for device, params := range pairs {
+		for _, p := range params {
+			if p == allParams {
+				allDevices = append(allDevices, device)
+				continue
+			}
+			pairDevices = append(pairDevices, device)
+			pairParams = append(pairParams, p)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT id, device_unique_id, parameter_name, value, recorded_at
+		FROM (
+			SELECT id, device_unique_id, parameter_name, value, recorded_at
+			FROM sensor_logs
+			WHERE device_unique_id = ANY($1)
+			   OR (device_unique_id, parameter_name) IN (
+					SELECT * FROM unnest($2::text[], $3::text[])
+			   )
+			ORDER BY id DESC
+			LIMIT $4
+		) t
+		ORDER BY id
+	`, pq.Array(allDevices), pq.Array(pairDevices), pq.Array(pairParams), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []liveReading
+	for rows.Next() {
+		var lr liveReading
+		if err := rows.Scan(&lr.ID, &lr.DeviceUniqueID, &lr.ParameterName, &lr.Value, &lr.RecordedAt); err != nil {
+			continue
+		}
+		readings = append(readings, lr)
+	}
+	return readings, nil
+}
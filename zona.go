@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/lib/pq"
+)
+
+// Data di database disimpan sebagai timestamp tanpa zona dalam WIB
+const zonaDatabase = "Asia/Jakarta"
+
+var lokasiWIB = time.FixedZone("WIB", 7*60*60)
+
+// Label pendek lama tetap diterima sebagai alias
+var zonaAliases = map[string]string{
+	"wib":  "Asia/Jakarta",
+	"wita": "Asia/Makassar",
+	"wit":  "Asia/Jayapura",
+}
+
+// Zona waktu jika parameter zonawaktu kosong
+var defaultZonaWaktu = "wib"
+
+// Zona waktu yang diminta client
+type Zona struct {
+	Name   string // nama IANA, mis. Asia/Makassar
+	Label  string // label respons: WIB/WITA/WIT atau nama IANA
+	Loc    *time.Location
+	Column string // ekspresi SQL recorded_at dalam zona ini
+}
+
+// Resolve zonawaktu (alias wib/wita/wit atau nama IANA)
+func resolveZona(zonaWaktu string) (Zona, error) {
+	if zonaWaktu == "" {
+		zonaWaktu = defaultZonaWaktu
+	}
+
+	name, label := zonaWaktu, zonaWaktu
+	if iana, ok := zonaAliases[strings.ToLower(zonaWaktu)]; ok {
+		name, label = iana, strings.ToUpper(zonaWaktu)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return Zona{}, fmt.Errorf("zonawaktu tidak dikenal: %s (gunakan wib, wita, wit atau nama IANA)", zonaWaktu)
+	}
+
+	z := Zona{Name: loc.String(), Label: label, Loc: loc}
+	z.Column = z.FromDatabaseExpr("recorded_at")
+	return z, nil
+}
+
+// Ekspresi SQL: kolom waktu database (WIB) -> waktu lokal di zona ini
+func (z Zona) FromDatabaseExpr(column string) string {
+	if z.Name == zonaDatabase {
+		return column
+	}
+	return fmt.Sprintf("((%s AT TIME ZONE %s) AT TIME ZONE %s)",
+		column, pq.QuoteLiteral(zonaDatabase), pq.QuoteLiteral(z.Name))
+}
+
+// Selisih zona ini terhadap WIB saat ini
+func (z Zona) offsetFromDatabase() time.Duration {
+	_, offset := time.Now().In(z.Loc).Zone()
+	return time.Duration(offset)*time.Second - 7*time.Hour
+}
+
+// Ekspresi SQL: waktu lokal di zona ini -> waktu database (WIB)
+func (z Zona) ToDatabase(expr string) string {
+	if z.Name == zonaDatabase {
+		return expr
+	}
+	return fmt.Sprintf("((%s) AT TIME ZONE %s AT TIME ZONE %s)",
+		expr, pq.QuoteLiteral(z.Name), pq.QuoteLiteral(zonaDatabase))
+}
+
+// Ekspresi SQL tanggal hari ini di zona ini
+func (z Zona) Today() string {
+	return fmt.Sprintf("(NOW() AT TIME ZONE %s)::date", pq.QuoteLiteral(z.Name))
+}
+
+// Batas [awal, akhir) satu hari; dateParam berisi tanggal YYYY-MM-DD
+func (z Zona) DayWindow(dateParam string) (string, string) {
+	return z.ToDatabase(dateParam + "::date::timestamp"),
+		z.ToDatabase(dateParam + "::date + INTERVAL '1 day'")
+}
+
+// Batas [awal, akhir) satu bulan kalender di zona ini
+func (z Zona) MonthWindow(yearParam, monthParam string) (string, string) {
+	start := fmt.Sprintf("make_date(%s::int, %s::int, 1)", yearParam, monthParam)
+	return z.ToDatabase(start + "::timestamp"),
+		z.ToDatabase(start + " + INTERVAL '1 month'")
+}
+
+// Batas awal N hari terakhir (termasuk hari ini) di zona ini
+func (z Zona) DaysAgo(days int) string {
+	return z.ToDatabase(fmt.Sprintf("%s - INTERVAL '%d DAYS'", z.Today(), days))
+}
+
+// Waktu dari database (WIB tanpa zona) ke zona ini
+func (z Zona) FromDatabase(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), lokasiWIB).In(z.Loc)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveZona(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantName  string
+		wantLabel string
+		wantErr   bool
+	}{
+		{"", "Asia/Jakarta", "WIB", false},
+		{"wib", "Asia/Jakarta", "WIB", false},
+		{"WITA", "Asia/Makassar", "WITA", false},
+		{"wit", "Asia/Jayapura", "WIT", false},
+		{"Asia/Makassar", "Asia/Makassar", "Asia/Makassar", false},
+		{"UTC", "UTC", "UTC", false},
+		{"Local", "", "", true},
+		{"Mars/Olympus", "", "", true},
+	}
+	for _, tt := range tests {
+		z, err := resolveZona(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveZona(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if z.Name != tt.wantName || z.Label != tt.wantLabel {
+			t.Errorf("resolveZona(%q) = %s/%s, want %s/%s", tt.in, z.Name, z.Label, tt.wantName, tt.wantLabel)
+		}
+	}
+}
+
+func TestZonaColumn(t *testing.T) {
+	wib, _ := resolveZona("wib")
+	if wib.Column != "recorded_at" {
+		t.Errorf("WIB tidak perlu konversi, dapat %s", wib.Column)
+	}
+	wita, _ := resolveZona("wita")
+	want := "((recorded_at AT TIME ZONE 'Asia/Jakarta') AT TIME ZONE 'Asia/Makassar')"
+	if wita.Column != want {
+		t.Errorf("WITA Column = %s, want %s", wita.Column, want)
+	}
+}
+
+func TestDayWindow(t *testing.T) {
+	tests := []struct {
+		zona       string
+		start, end string
+	}{
+		{"wib", "$1::date::timestamp", "$1::date + INTERVAL '1 day'"},
+		{"wita",
+			"(($1::date::timestamp) AT TIME ZONE 'Asia/Makassar' AT TIME ZONE 'Asia/Jakarta')",
+			"(($1::date + INTERVAL '1 day') AT TIME ZONE 'Asia/Makassar' AT TIME ZONE 'Asia/Jakarta')"},
+	}
+	for _, tt := range tests {
+		z, _ := resolveZona(tt.zona)
+		start, end := z.DayWindow("$1")
+		if start != tt.start || end != tt.end {
+			t.Errorf("%s DayWindow = %s / %s, want %s / %s", tt.zona, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestFromDatabase(t *testing.T) {
+	// recorded_at tersimpan sebagai waktu dinding WIB tanpa zona
+	stored := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		zona string
+		want string
+	}{
+		{"wib", "2026-03-01 23:30:00 +0700"},
+		{"wita", "2026-03-02 00:30:00 +0800"},
+		{"wit", "2026-03-02 01:30:00 +0900"},
+		{"UTC", "2026-03-01 16:30:00 +0000"},
+	}
+	for _, tt := range tests {
+		z, _ := resolveZona(tt.zona)
+		got := z.FromDatabase(stored).Format("2006-01-02 15:04:05 -0700")
+		if got != tt.want {
+			t.Errorf("%s FromDatabase = %s, want %s", tt.zona, got, tt.want)
+		}
+	}
+}
+
+func TestMonthWindow(t *testing.T) {
+	z, _ := resolveZona("wit")
+	start, end := z.MonthWindow("$2", "$3")
+	if !strings.Contains(start, "make_date($2::int, $3::int, 1)::timestamp") ||
+		!strings.Contains(end, "INTERVAL '1 month'") ||
+		!strings.HasSuffix(end, "AT TIME ZONE 'Asia/Jayapura' AT TIME ZONE 'Asia/Jakarta')") {
+		t.Errorf("MonthWindow = %s / %s", start, end)
+	}
+}